@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/capacity": {
             "post": {
-                "description": "Calculates the maximum size of a secret file (in bytes) that can be embedded into an uploaded audio file (MP3 or WAV) using different steganography methods. The capacity is returned for LSB methods (1-4 LSBs) and Parity method (1 bit per byte).",
+                "description": "Calculates how many bytes of secret fit into an uploaded audio file (MP3 or WAV) with every method, see /embed for how each method stores its bits.\nEvery capacity is reported raw and after the Reed–Solomon parity of each ECC level.\nThe DSSS capacity is calculated for chip_rate (returned as dsss_chip_rate); one layer of a deniable embedding (see /embed/deniable) is reported as deniable_layer.\nWhen a secret file is uploaded as well, the response tells whether it fits after compression.",
                 "consumes": [
                     "multipart/form-data"
                 ],
@@ -35,35 +35,929 @@ const docTemplate = `{
                         "name": "audio",
                         "in": "formData",
                         "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "Optional secret file; checked against every method with its default options, container overhead included.",
+                        "name": "secret",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Chip rate the DSSS capacity is calculated for (power of two from 256 to 16384, default 2048).",
+                        "name": "chip_rate",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully calculated embedding capacity.",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CapacityResponse"
+                        },
+                        "headers": {
+                            "X-Processing-Time": {
+                                "type": "int",
+                                "description": "Time taken to process the request in milliseconds"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request: No file uploaded, file is not MP3/WAV, or file is corrupted.",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "File too large",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error: Failed to process the file.",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/embed": {
+            "post": {
+                "description": "Embeds one or more secret files into a cover audio file (MP3 or 16-bit PCM WAV) and returns the stego audio.\nMethods:\n- lsb: 1-4 least significant bits of every carrier byte.\n- parity: 1 bit per carrier byte, stored in the parity of its LSB.\n- bitstream: MP3 only, 1 bit in the global_gain of every granule; the stego MP3 stays decodable.\n- lsb_matching: 1 bit per carrier byte, changed by a random ±1 so no pairs-of-values artefact is left.\n- echo: 1 bit per 2048 samples as a pair of faint echoes read from the cepstrum; needs ecc 'medium' or 'high'.\n- phase: 1 bit per frequency bin of a mid band in the phase of the first loud 65536-sample segment; later segments are rotated along to keep their phase differences.\n- dsss: 1 bit per chip_rate samples as pseudo-noise keyed with the stego key; read back after added noise or a start delay of up to 4096 samples.\n- qim: 1 bit per sample, quantized onto one of two lattices dithered with the stego key.\n- dct: 1 bit per mid-frequency DCT coefficient, 128 per 1024-sample block and channel.\n\nEcho, phase, dsss, qim and dct work on the decoded audio and always return WAV; the other methods keep the format of the cover.\nThe PSNR and SNR against the cover are returned in the X-PSNR-Value and X-SNR-Value headers.\nSecrets are compressed, optionally encrypted, and packed with their names, sizes and modification times into a container inside the stego file.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "audio/mpeg",
+                    "audio/wav"
+                ],
+                "tags": [
+                    "Steganography"
+                ],
+                "summary": "Embed secret file into audio",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Cover audio file (MP3 or 16-bit PCM WAV)",
+                        "name": "audio",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "Secret file to embed; repeat the field to embed several files together",
+                        "name": "secret",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Modification time (unix seconds) of each secret file, repeated in upload order; defaults to the upload time",
+                        "name": "secret_mtime",
+                        "in": "formData"
+                    },
+                    {
+                        "enum": [
+                            "lsb",
+                            "parity",
+                            "bitstream",
+                            "lsb_matching",
+                            "echo",
+                            "phase",
+                            "dsss",
+                            "qim",
+                            "dct"
+                        ],
+                        "type": "string",
+                        "description": "Steganography method, see the list above",
+                        "name": "method",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of LSBs to use (1-4), required only for LSB method",
+                        "name": "lsb",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key for encryption, random start and/or scatter",
+                        "name": "stego_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Enable encryption of the secret",
+                        "name": "use_encryption",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cipher used when encryption is enabled: 'vigenere' (extended 256-symbol Vigenère, default) or 'aes-gcm' (AES-256-GCM)",
+                        "name": "cipher",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Recipient public key ('astego-pub-...'); repeat the field for several recipients. The secret is then encrypted with AES-256-GCM under a random file key that only their private keys can unwrap, no stego key is needed",
+                        "name": "recipient",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "Text file with recipient public keys, one per line; repeat the field for several files",
+                        "name": "recipients_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Signing key ('ASTEGO-SIGNING-KEY-...') from /keys with type 'signing'; the container is signed with Ed25519 so recipients can verify the sender",
+                        "name": "signing_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "Key file holding the signing key, as downloaded from /keys; used when signing_key is not given",
+                        "name": "signing_key_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Enable random start embedding",
+                        "name": "use_random_start",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Scatter the payload bits over the whole cover with a key-driven permutation (overrides random start)",
+                        "name": "use_scatter",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Argon2id passes used to derive keys from the stego key (1-4, default 3)",
+                        "name": "kdf_time",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Argon2id memory cost in MiB (8-256, default 64)",
+                        "name": "kdf_memory",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Argon2id parallelism (1-16, default 4)",
+                        "name": "kdf_threads",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Keep the KDF cost and container header readable without the key (by default they are hidden when a stego key is given)",
+                        "name": "public_header",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reed–Solomon error correction: 'none', 'low', 'medium' or 'high' (16, 32 or 64 parity bytes per 255-byte block). Defaults to 'high' for the methods that work on the decoded audio and 'none' otherwise; echo needs at least 'medium'",
+                        "name": "ecc",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Decode an MP3 cover and embed into its samples; the stego file is then WAV. Always done by the methods that work on the decoded audio",
+                        "name": "decode_to_pcm",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "DSSS method only: samples spreading one bit, a power of two from 256 to 16384 (default 2048); more chips survive more distortion but lower the capacity",
+                        "name": "chip_rate",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "DSSS method only: amplitude of the chips relative to the RMS of the music, above 0 and at most 1 (default 0.05)",
+                        "name": "gain",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "QIM method only: quantization step in sample units, a power of two from 2 to 1024 (default 64); a larger step survives more distortion but changes every sample by up to half a step",
+                        "name": "qim_step",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Output stego audio filename",
+                        "name": "output_filename",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stego audio file with embedded secret (same format as the cover, or WAV when decode_to_pcm is set)",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Processing error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/embed/deniable": {
+            "post": {
+                "description": "Embeds a decoy and a hidden secret into two equal layers of one cover for plausible deniability.\nThe decoy is scattered over one layer under stego_key, the hidden secret over the other under hidden_stego_key, and unused carrier bits are filled with random bits.\n/extract with either key returns only the secret of that key; nothing read with the decoy key shows whether the other layer holds a secret.\nEach layer holds half of the capacity of the method (deniable_layer in /capacity).\nThe other options are those of /embed and apply to both layers, which are always scattered behind hidden headers.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "audio/mpeg",
+                    "audio/wav"
+                ],
+                "tags": [
+                    "Steganography"
+                ],
+                "summary": "Embed decoy and hidden secret files into audio (deniable)",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Cover audio file (MP3 or 16-bit PCM WAV)",
+                        "name": "audio",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "Decoy secret file; repeat the field to embed several files together",
+                        "name": "secret",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Modification time (unix seconds) of each decoy file, repeated in upload order; defaults to the upload time",
+                        "name": "secret_mtime",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key of the decoy layer",
+                        "name": "stego_key",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "Hidden secret file; repeat the field to embed several files together. Without it the second layer only holds random bits",
+                        "name": "hidden_secret",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Modification time (unix seconds) of each hidden file, repeated in upload order; defaults to the upload time",
+                        "name": "hidden_mtime",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key of the hidden layer, required with hidden_secret and different from stego_key",
+                        "name": "hidden_stego_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed; dsss and qim are not supported, their carrier is keyed with the key of one layer",
+                        "name": "method",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "lsb",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "use_encryption",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "cipher",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "recipient",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "recipients_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "signing_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "signing_key_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_time",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_memory",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_threads",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "ecc",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "decode_to_pcm",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Output stego audio filename",
+                        "name": "output_filename",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stego audio file with both layers (same format as the cover, or WAV when decode_to_pcm is set)",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input, missing or equal stego keys, or a secret larger than one layer",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Processing error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/embed/shards": {
+            "post": {
+                "description": "Splits a secret too large for one cover across several covers, in proportion to their capacity.\nEvery cover gets a complete container with a shard record: a random set identifier, its sequence number and the shard count.\nThe stego files are returned in a ZIP or tar archive, in upload order.\nThe embedding options are those of /embed and apply to every shard.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/zip",
+                    "application/x-tar"
+                ],
+                "tags": [
+                    "Steganography"
+                ],
+                "summary": "Split secret file across several audio files",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Cover audio files (MP3 or 16-bit PCM WAV); repeat the field once per cover, at least 2",
+                        "name": "audio",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "secret",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "secret_mtime",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "method",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "lsb",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "stego_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "use_encryption",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "cipher",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "recipient",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "recipients_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "signing_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "signing_key_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "use_random_start",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "use_scatter",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_time",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_memory",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_threads",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "public_header",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "ecc",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "decode_to_pcm",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "chip_rate",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "See /embed",
+                        "name": "gain",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "qim_step",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Archive format the stego files are returned in: 'zip' (default) or 'tar'",
+                        "name": "archive",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Output archive filename",
+                        "name": "output_filename",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ZIP or tar archive with one stego file per cover, named after the cover and its shard number",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input or insufficient combined capacity",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Processing error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/embed/shares": {
+            "post": {
+                "description": "Splits a secret with Shamir secret sharing over GF(2^8): any threshold (k) of the n stego files recover it, fewer reveal nothing but its size.\nEvery cover (up to 255) gets one share in a complete container that records a random set identifier, its share index, the threshold and the share count.\nEach cover must be able to hold a whole share.\nThe stego files are returned in a ZIP or tar archive, in upload order.\nThe embedding options are those of /embed and apply to every share.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/zip",
+                    "application/x-tar"
+                ],
+                "tags": [
+                    "Steganography"
+                ],
+                "summary": "Share secret file across several audio files (k-of-n)",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Cover audio files (MP3 or 16-bit PCM WAV); repeat the field once per cover, 2 to 255 covers",
+                        "name": "audio",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of stego files needed to recover the secret (2 up to the number of covers)",
+                        "name": "threshold",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "secret",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "secret_mtime",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "method",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "lsb",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "stego_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "use_encryption",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "cipher",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "recipient",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "recipients_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "signing_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /embed",
+                        "name": "signing_key_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "use_random_start",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "use_scatter",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_time",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_memory",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "kdf_threads",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "public_header",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /embed",
+                        "name": "ecc",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "See /embed",
+                        "name": "decode_to_pcm",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "chip_rate",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "See /embed",
+                        "name": "gain",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /embed",
+                        "name": "qim_step",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Archive format the stego files are returned in: 'zip' (default) or 'tar'",
+                        "name": "archive",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Output archive filename",
+                        "name": "output_filename",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "ZIP or tar archive with one stego file per cover, named after the cover and its share index",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid input, invalid threshold or a cover too small for a share",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Processing error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/extract": {
+            "post": {
+                "description": "Extracts the secret files embedded by /embed, detecting the method unless one is given.\nThe cipher and all other embedding options are read from the container; only keys have to be supplied.\nThe signature is reported in X-Signature-Status ('verified', 'untrusted', 'invalid' or 'unsigned') and the signer in X-Signer.\nA wrong key and tampered data are reported separately, since every container carries an integrity tag.\nMulti-file payloads are returned as a ZIP or tar archive; for stego files from /embed/deniable the key selects the layer.\nStego files with the older v2 header are still supported.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/octet-stream",
+                    "application/zip",
+                    "application/x-tar"
+                ],
+                "tags": [
+                    "Steganography"
+                ],
+                "summary": "Extract secret file from audio",
+                "parameters": [
+                    {
+                        "type": "file",
+                        "description": "Stego audio file (MP3 or WAV with embedded data)",
+                        "name": "stego_audio",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "enum": [
+                            "lsb",
+                            "parity",
+                            "bitstream",
+                            "lsb_matching",
+                            "echo",
+                            "phase",
+                            "dsss",
+                            "qim",
+                            "dct"
+                        ],
+                        "type": "string",
+                        "description": "Method used at embedding; speeds up extraction, auto-detected when empty",
+                        "name": "method",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key for decryption, random start and/or scatter",
+                        "name": "stego_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Private key ('ASTEGO-SECRET-KEY-...') for secrets encrypted to recipients; repeat the field for several keys",
+                        "name": "identity",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "Identity file with private keys, one per line, as downloaded from /keys; repeat the field for several files",
+                        "name": "identity_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Public key ('astego-signer-...') of a trusted sender; repeat the field for several senders. A valid signature by one of them is reported as 'verified'",
+                        "name": "trusted_signer",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "Text file with trusted signer public keys, one per line; repeat the field for several files",
+                        "name": "signers_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Argon2id passes used at embedding, only needed for hidden headers with non-default cost",
+                        "name": "kdf_time",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Argon2id memory cost in MiB used at embedding, only needed for hidden headers with non-default cost",
+                        "name": "kdf_memory",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Argon2id parallelism used at embedding, only needed for hidden headers with non-default cost",
+                        "name": "kdf_threads",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Archive format for multi-file payloads: 'zip' (default) or 'tar'",
+                        "name": "archive",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Optional output filename override",
+                        "name": "output_filename",
+                        "in": "formData"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully calculated embedding capacity.",
+                        "description": "Extracted secret file, or a ZIP/tar archive of all files for multi-file payloads",
                         "schema": {
-                            "$ref": "#/definitions/handlers.CapacityResponse"
-                        },
-                        "headers": {
-                            "X-Processing-Time": {
-                                "type": "int",
-                                "description": "Time taken to process the request in milliseconds"
-                            }
+                            "type": "file"
                         }
                     },
                     "400": {
-                        "description": "Bad Request: No file uploaded, file is not MP3/WAV, or file is corrupted.",
+                        "description": "Invalid input, wrong stego key or no matching private key",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
-                    "413": {
-                        "description": "File too large",
+                    "422": {
+                        "description": "Integrity check failed, the embedded data was modified",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error: Failed to process the file.",
+                        "description": "Extraction error",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
@@ -71,87 +965,117 @@ const docTemplate = `{
                 }
             }
         },
-        "/embed": {
+        "/extract/shards": {
             "post": {
-                "description": "Embeds a secret file into the provided audio file using LSB or Parity steganography method. LSB method supports 1-4 LSBs, while Parity method uses 1 bit per byte. Supports optional Vigenère encryption and random embedding start using a stego key. Metadata (filename, format, size, method, flags) is automatically stored inside the stego file.",
+                "description": "Extracts the shards of a secret split with /embed/shards, uploaded in any order, and reassembles it.\nWhen shards are missing, the error details list the set identifier, the shard count and the sequence numbers found and missing.\nThe secret is returned like /extract returns it; the signature status is the least trustworthy one of the shards.",
                 "consumes": [
                     "multipart/form-data"
                 ],
                 "produces": [
-                    "audio/mpeg"
+                    "application/octet-stream",
+                    "application/zip",
+                    "application/x-tar"
                 ],
                 "tags": [
                     "Steganography"
                 ],
-                "summary": "Embed secret file into audio",
+                "summary": "Reassemble secret file from several audio files",
                 "parameters": [
                     {
                         "type": "file",
-                        "description": "Cover audio file (MP3)",
-                        "name": "audio",
+                        "description": "Stego audio files holding the shards; repeat the field once per file, in any order",
+                        "name": "stego_audio",
                         "in": "formData",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "See /extract",
+                        "name": "method",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /extract",
+                        "name": "stego_key",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /extract",
+                        "name": "identity",
+                        "in": "formData"
+                    },
                     {
                         "type": "file",
-                        "description": "Secret file to embed",
-                        "name": "secret",
-                        "in": "formData",
-                        "required": true
+                        "description": "See /extract",
+                        "name": "identity_file",
+                        "in": "formData"
                     },
                     {
                         "type": "string",
-                        "description": "Steganography method: 'lsb' or 'parity'",
-                        "name": "method",
-                        "in": "formData",
-                        "required": true
+                        "description": "See /extract",
+                        "name": "trusted_signer",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /extract",
+                        "name": "signers_file",
+                        "in": "formData"
                     },
                     {
                         "type": "integer",
-                        "description": "Number of LSBs to use (1-4), required only for LSB method",
-                        "name": "lsb",
+                        "description": "See /extract",
+                        "name": "kdf_time",
                         "in": "formData"
                     },
                     {
-                        "type": "string",
-                        "description": "Key for encryption and/or random start",
-                        "name": "stego_key",
+                        "type": "integer",
+                        "description": "See /extract",
+                        "name": "kdf_memory",
                         "in": "formData"
                     },
                     {
-                        "type": "boolean",
-                        "description": "Enable Vigenère encryption",
-                        "name": "use_encryption",
+                        "type": "integer",
+                        "description": "See /extract",
+                        "name": "kdf_threads",
                         "in": "formData"
                     },
                     {
-                        "type": "boolean",
-                        "description": "Enable random start embedding",
-                        "name": "use_random_start",
+                        "type": "string",
+                        "description": "Archive format for multi-file payloads: 'zip' (default) or 'tar'",
+                        "name": "archive",
                         "in": "formData"
                     },
                     {
                         "type": "string",
-                        "description": "Output stego audio filename",
+                        "description": "Optional output filename override",
                         "name": "output_filename",
                         "in": "formData"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Stego audio file with embedded secret",
+                        "description": "Reassembled secret file, or a ZIP/tar archive of all files for multi-file payloads",
                         "schema": {
                             "type": "file"
                         }
                     },
                     "400": {
-                        "description": "Invalid input",
+                        "description": "Invalid input, wrong stego key or files from different shard sets",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Shards are missing or the integrity check failed",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Processing error",
+                        "description": "Extraction error",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
@@ -159,39 +1083,89 @@ const docTemplate = `{
                 }
             }
         },
-        "/extract": {
+        "/extract/shares": {
             "post": {
-                "description": "Extracts a secret file that was previously embedded in an audio file using LSB or Parity steganography. Auto-detects the method used during embedding. Supports optional Vigenère decryption and random start. Automatically restores original filename and metadata.",
+                "description": "Extracts the shares of a secret shared with /embed/shares, uploaded in any order, and recovers it from at least threshold distinct shares.\nWith too few shares, the error details list the set identifier, the threshold, the share count, the indices found and how many more are needed.\nThe secret is returned like /extract returns it; the signature status is the least trustworthy one of the shares.",
                 "consumes": [
                     "multipart/form-data"
                 ],
                 "produces": [
-                    "application/octet-stream"
+                    "application/octet-stream",
+                    "application/zip",
+                    "application/x-tar"
                 ],
                 "tags": [
                     "Steganography"
                 ],
-                "summary": "Extract secret file from audio",
+                "summary": "Recover secret file from k of n audio files",
                 "parameters": [
                     {
                         "type": "file",
-                        "description": "Stego audio file (MP3 with embedded data)",
+                        "description": "Stego audio files holding the shares; repeat the field once per file, in any order",
                         "name": "stego_audio",
                         "in": "formData",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Optional: specify method ('lsb' or 'parity') to speed up extraction",
+                        "description": "See /extract",
                         "name": "method",
                         "in": "formData"
                     },
                     {
                         "type": "string",
-                        "description": "Key for decryption and/or random start",
+                        "description": "See /extract",
                         "name": "stego_key",
                         "in": "formData"
                     },
+                    {
+                        "type": "string",
+                        "description": "See /extract",
+                        "name": "identity",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /extract",
+                        "name": "identity_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "See /extract",
+                        "name": "trusted_signer",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "See /extract",
+                        "name": "signers_file",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /extract",
+                        "name": "kdf_time",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /extract",
+                        "name": "kdf_memory",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "See /extract",
+                        "name": "kdf_threads",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Archive format for multi-file payloads: 'zip' (default) or 'tar'",
+                        "name": "archive",
+                        "in": "formData"
+                    },
                     {
                         "type": "string",
                         "description": "Optional output filename override",
@@ -201,13 +1175,19 @@ const docTemplate = `{
                 ],
                 "responses": {
                     "200": {
-                        "description": "Extracted secret file",
+                        "description": "Recovered secret file, or a ZIP/tar archive of all files for multi-file payloads",
                         "schema": {
                             "type": "file"
                         }
                     },
                     "400": {
-                        "description": "Invalid input",
+                        "description": "Invalid input, wrong stego key or files from different share sets",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Too few shares or the integrity check failed",
                         "schema": {
                             "$ref": "#/definitions/models.ErrorResponse"
                         }
@@ -246,6 +1226,56 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/keys": {
+            "post": {
+                "description": "Generates a key pair; the server does not keep any key. A recipient key pair (X25519, the default) is used for public-key embedding: secrets embedded with the public key as a recipient can only be extracted with the private key, so no stego key has to be shared. Its public key is text starting with 'astego-pub-', its private key text starting with 'ASTEGO-SECRET-KEY-'. A signing key pair (Ed25519) signs embedded containers: the private key ('ASTEGO-SIGNING-KEY-...') is given as signing_key when embedding and the public key ('astego-signer-...') as trusted_signer when extracting. With download set, the private key is returned as a key file (the private key line preceded by comments with the creation time and the public key), which can be uploaded again as identity_file or signing_key_file.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/plain"
+                ],
+                "tags": [
+                    "Keys"
+                ],
+                "summary": "Generate key pair",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key pair type: 'recipient' (X25519, default) or 'signing' (Ed25519)",
+                        "name": "type",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Return the key file as a download instead of JSON",
+                        "name": "download",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Generated key pair, or the key file when download is set",
+                        "schema": {
+                            "$ref": "#/definitions/models.KeyPair"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid key type",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Key generation error",
+                        "schema": {
+                            "$ref": "#/definitions/models.ErrorResponse"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
@@ -260,6 +1290,9 @@ const docTemplate = `{
                 },
                 "processing_time_ms": {
                     "type": "integer"
+                },
+                "secret": {
+                    "$ref": "#/definitions/handlers.SecretFit"
                 }
             }
         },
@@ -309,6 +1342,27 @@ const docTemplate = `{
                 }
             }
         },
+        "handlers.SecretFit": {
+            "type": "object",
+            "properties": {
+                "compressed_size_bytes": {
+                    "type": "integer"
+                },
+                "filename": {
+                    "type": "string"
+                },
+                "fits": {
+                    "description": "keyed like the capacities: 1_lsb ... 4_lsb, parity, bitstream",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "boolean"
+                    }
+                },
+                "size_bytes": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.CapacityResult": {
             "type": "object",
             "properties": {
@@ -325,9 +1379,56 @@ const docTemplate = `{
                 "4_lsb": {
                     "type": "integer"
                 },
+                "bitstream": {
+                    "description": "MP3 bitstream capacity (1 bit per granule and channel, 0 for WAV covers)",
+                    "type": "integer"
+                },
+                "dct": {
+                    "description": "DCT coefficient capacity (1 bit per mid-frequency coefficient, 128 per 1024-sample block and channel of the decoded audio)",
+                    "type": "integer"
+                },
+                "deniable_layer": {
+                    "description": "Capacities of each of the two layers of a deniable embedding, which share the carrier",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.CapacityResult"
+                        }
+                    ]
+                },
+                "dsss": {
+                    "description": "Direct-sequence spread spectrum capacity (1 bit per dsss_chip_rate samples of the decoded audio)",
+                    "type": "integer"
+                },
+                "dsss_chip_rate": {
+                    "description": "Chip rate the DSSS capacity is given for",
+                    "type": "integer"
+                },
+                "ecc": {
+                    "description": "Effective capacities left for the secret once Reed–Solomon parity is added, per ECC level",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.CapacityResult"
+                    }
+                },
+                "echo": {
+                    "description": "Echo hiding capacity (1 bit per 2048 samples of the decoded audio)",
+                    "type": "integer"
+                },
+                "lsb_matching": {
+                    "description": "LSB matching capacity (1 bit per byte, the slots of 1 LSB)",
+                    "type": "integer"
+                },
                 "parity": {
                     "description": "Parity coding capacity (1 bit per byte)",
                     "type": "integer"
+                },
+                "phase": {
+                    "description": "Phase coding capacity (1 bit per frequency bin of one 16384-sample segment of the decoded audio)",
+                    "type": "integer"
+                },
+                "qim": {
+                    "description": "Quantization index modulation capacity (1 bit per sample of the decoded audio)",
+                    "type": "integer"
                 }
             }
         },
@@ -353,6 +1454,20 @@ const docTemplate = `{
                     "type": "boolean"
                 }
             }
+        },
+        "models.KeyPair": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "private_key": {
+                    "type": "string"
+                },
+                "public_key": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
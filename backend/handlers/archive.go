@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// buildArchive packs the files of a multi-file payload into a ZIP or tar archive,
+// keeping their names and modification times
+func buildArchive(format models.ArchiveFormat, entries []models.SecretEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case models.ArchiveTar:
+		tw := tar.NewWriter(&buf)
+		for i, e := range entries {
+			header := &tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     entryName(e.Name, i),
+				Size:     int64(len(e.Data)),
+				Mode:     0644,
+				ModTime:  e.ModTime,
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				return nil, err
+			}
+			if _, err := tw.Write(e.Data); err != nil {
+				return nil, err
+			}
+		}
+		if err := tw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		zw := zip.NewWriter(&buf)
+		for i, e := range entries {
+			w, err := zw.CreateHeader(&zip.FileHeader{
+				Name:     entryName(e.Name, i),
+				Method:   zip.Deflate,
+				Modified: e.ModTime,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(e.Data); err != nil {
+				return nil, err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// entryName strips directories from a stored file name so a crafted stego file cannot make the
+// archive write outside the folder it is unpacked into
+func entryName(name string, index int) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if base == "." || base == "/" || base == ".." {
+		return fmt.Sprintf("file-%d", index+1)
+	}
+	return base
+}
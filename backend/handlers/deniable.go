@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// EmbedDeniableHandler embeds a decoy and a hidden secret into one audio file under two stego keys
+// @Summary      Embed decoy and hidden secret files into audio (deniable)
+// @Description  Embeds a decoy and a hidden secret into two equal layers of one cover for plausible deniability.
+// @Description  The decoy is scattered over one layer under stego_key, the hidden secret over the other under hidden_stego_key, and unused carrier bits are filled with random bits.
+// @Description  /extract with either key returns only the secret of that key; nothing read with the decoy key shows whether the other layer holds a secret.
+// @Description  Each layer holds half of the capacity of the method (deniable_layer in /capacity).
+// @Description  The other options are those of /embed and apply to both layers, which are always scattered behind hidden headers.
+// @Tags         Steganography
+// @Accept       multipart/form-data
+// @Produce      audio/mpeg,audio/wav
+// @Param        audio            formData  file   true  "Cover audio file (MP3 or 16-bit PCM WAV)"
+// @Param        secret           formData  file   true  "Decoy secret file; repeat the field to embed several files together"
+// @Param        secret_mtime     formData  int    false "Modification time (unix seconds) of each decoy file, repeated in upload order; defaults to the upload time"
+// @Param        stego_key        formData  string true  "Key of the decoy layer"
+// @Param        hidden_secret    formData  file   false "Hidden secret file; repeat the field to embed several files together. Without it the second layer only holds random bits"
+// @Param        hidden_mtime     formData  int    false "Modification time (unix seconds) of each hidden file, repeated in upload order; defaults to the upload time"
+// @Param        hidden_stego_key formData  string false "Key of the hidden layer, required with hidden_secret and different from stego_key"
+// @Param        method           formData  string true  "See /embed; dsss and qim are not supported, their carrier is keyed with the key of one layer"
+// @Param        lsb              formData  int    false "See /embed"
+// @Param        use_encryption   formData  bool   false "See /embed"
+// @Param        cipher           formData  string false "See /embed"
+// @Param        recipient        formData  string false "See /embed"
+// @Param        recipients_file  formData  file   false "See /embed"
+// @Param        signing_key      formData  string false "See /embed"
+// @Param        signing_key_file formData  file   false "See /embed"
+// @Param        kdf_time         formData  int    false "See /embed"
+// @Param        kdf_memory       formData  int    false "See /embed"
+// @Param        kdf_threads      formData  int    false "See /embed"
+// @Param        ecc              formData  string false "See /embed"
+// @Param        decode_to_pcm    formData  bool   false "See /embed"
+// @Param        output_filename  formData  string false "Output stego audio filename"
+// @Success      200  {file}  binary  "Stego audio file with both layers (same format as the cover, or WAV when decode_to_pcm is set)"
+// @Failure      400  {object}  models.ErrorResponse "Invalid input, missing or equal stego keys, or a secret larger than one layer"
+// @Failure      500  {object}  models.ErrorResponse "Processing error"
+// @Router       /embed/deniable [post]
+func (h *Handlers) EmbedDeniableHandler(c *gin.Context) {
+	startTime := time.Now()
+
+	// === Ambil file audio ===
+	audioHeader, err := c.FormFile("audio")
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "MISSING_FILES", "Audio file not provided")
+		return
+	}
+	audioFile, _ := audioHeader.Open()
+	defer audioFile.Close()
+	audioData, _ := io.ReadAll(audioFile)
+
+	// === Ambil file secret dan parameter; layer tersembunyi memakai opsi yang sama ===
+	decoyReq, ok := h.parseEmbedRequest(c, startTime)
+	if !ok {
+		return
+	}
+	decoyReq.CoverAudio = audioData
+	var hiddenReq *models.EmbedRequest
+	if _, err := c.FormFile("hidden_secret"); err == nil {
+		hidden, ok := readSecret(c, "hidden_secret", "hidden_mtime", startTime)
+		if !ok {
+			return
+		}
+		layer := *decoyReq
+		layer.SecretFile, layer.SecretFileName, layer.SecretMimeType, layer.SecretEntries =
+			hidden.SecretFile, hidden.SecretFileName, hidden.SecretMimeType, hidden.SecretEntries
+		layer.StegoKey = c.PostForm("hidden_stego_key")
+		hiddenReq = &layer
+	}
+	if decoyReq.StegoKey == "" || (hiddenReq != nil && (hiddenReq.StegoKey == "" || hiddenReq.StegoKey == decoyReq.StegoKey)) {
+		sendError(c, http.StatusBadRequest, "INVALID_STEGO_KEY", models.ErrDeniableKeys.Error())
+		return
+	}
+
+	// === Embed melalui service ===
+	var hiddenData []byte
+	if hiddenReq != nil {
+		hiddenData = hiddenReq.SecretFile
+	}
+	stegoAudio, distortion, err := h.steganographyService.EmbedDeniable(decoyReq, decoyReq.SecretFile, hiddenReq, hiddenData)
+	if err != nil {
+		switch err {
+		case models.ErrInsufficientCapacity:
+			// report the capacity of one layer, against the decoded PCM when the cover was decoded
+			capacityAudio := audioData
+			if decoyReq.DecodeToPCM {
+				if decoded, decodeErr := h.steganographyService.DecodeToWAV(audioData); decodeErr == nil {
+					capacityAudio = decoded
+				}
+			}
+			layerCapacity := 0
+			if capacity, capacityErr := h.steganographyService.CalculateCapacity(capacityAudio, 0); capacityErr == nil {
+				layerCapacity = methodCapacity(capacity.Layer, decoyReq.Method, decoyReq.NLsb, decoyReq.ECC)
+			}
+			sendError(c, http.StatusBadRequest, "INSUFFICIENT_CAPACITY",
+				fmt.Sprintf("Secret file sizes (decoy %d bytes compressed, hidden %d bytes compressed) exceed the capacity of one layer (%d bytes) for %s method",
+					h.steganographyService.EstimateSecretSize(decoyReq.SecretFile), h.steganographyService.EstimateSecretSize(hiddenData), layerCapacity, decoyReq.Method))
+		case models.ErrDeniableKeys:
+			sendError(c, http.StatusBadRequest, "INVALID_STEGO_KEY", err.Error())
+		case models.ErrDeniableMethod:
+			sendError(c, http.StatusBadRequest, "INVALID_METHOD", err.Error())
+		default:
+			sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to embed data: "+err.Error())
+		}
+		return
+	}
+
+	processingTime := int(time.Since(startTime).Milliseconds())
+
+	// Stego audio keeps the container format of the cover (MP3 or WAV)
+	outputFormat := h.audioService.DetectFormat(stegoAudio)
+	outputFilename := c.PostForm("output_filename")
+	if outputFilename == "" {
+		outputFilename = "stego_audio" + outputFormat.Extension()
+	}
+
+	// === Set header response ===
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", outputFilename))
+	c.Header("X-PSNR-Value", fmt.Sprintf("%.2f", distortion.PSNR))
+	c.Header("X-SNR-Value", fmt.Sprintf("%.2f", distortion.SNR))
+	c.Header("X-Embedding-Method", embeddingMethodName(decoyReq.Method, decoyReq.NLsb))
+	c.Header("X-Secret-Size", strconv.Itoa(len(decoyReq.SecretFile)))
+	c.Header("X-Processing-Time", strconv.Itoa(processingTime))
+	c.Header("X-Output-Format", strings.ToUpper(string(outputFormat)))
+
+	c.Data(http.StatusOK, outputFormat.MimeType(), stegoAudio)
+}
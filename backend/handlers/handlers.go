@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"path/filepath"
 	"strconv"
@@ -51,9 +53,19 @@ type HealthResponse struct {
 type CapacityResponse struct {
 	Capacities       models.CapacityResult `json:"capacities"`
 	FileInfo         FileInfo              `json:"file_info"`
+	Secret           *SecretFit            `json:"secret,omitempty"`
 	ProcessingTimeMs int                   `json:"processing_time_ms"`
 }
 
+// SecretFit reports whether an optional secret file fits the cover once compressed, with the
+// container overhead of an embedding without stego key at the default ECC level of each method
+type SecretFit struct {
+	Filename            string          `json:"filename"`
+	SizeBytes           int             `json:"size_bytes"`
+	CompressedSizeBytes int             `json:"compressed_size_bytes"`
+	Fits                map[string]bool `json:"fits"` // keyed like the capacities: 1_lsb ... 4_lsb, parity, bitstream, lsb_matching, echo, phase, dsss, qim, dct
+}
+
 // FileInfo represents audio file information
 type FileInfo struct {
 	Filename        string  `json:"filename"`
@@ -95,11 +107,16 @@ func (h *Handlers) HealthHandler(c *gin.Context) {
 // CalculateCapacityHandler handles the capacity calculation request
 //
 //	@Summary		Calculate Audio Embedding Capacity
-//	@Description	Calculates the maximum size of a secret file (in bytes) that can be embedded into an uploaded audio file (MP3 or WAV) using different steganography methods. The capacity is returned for LSB methods (1-4 LSBs) and Parity method (1 bit per byte).
+//	@Description	Calculates how many bytes of secret fit into an uploaded audio file (MP3 or WAV) with every method, see /embed for how each method stores its bits.
+//	@Description	Every capacity is reported raw and after the Reed–Solomon parity of each ECC level.
+//	@Description	The DSSS capacity is calculated for chip_rate (returned as dsss_chip_rate); one layer of a deniable embedding (see /embed/deniable) is reported as deniable_layer.
+//	@Description	When a secret file is uploaded as well, the response tells whether it fits after compression.
 //	@Tags			Steganography
 //	@Accept			multipart/form-data
 //	@Produce		json
 //	@Param			audio	formData	file					true	"Audio file (MP3 or WAV) to calculate capacity for."
+//	@Param			secret	formData	file					false	"Optional secret file; checked against every method with its default options, container overhead included."
+//	@Param			chip_rate	formData	int					false	"Chip rate the DSSS capacity is calculated for (power of two from 256 to 16384, default 2048)."
 //	@Success		200		{object}	CapacityResponse		"Successfully calculated embedding capacity."
 //	@Header			200		{int}		X-Processing-Time		"Time taken to process the request in milliseconds"
 //	@Failure		400		{object}	models.ErrorResponse	"Bad Request: No file uploaded, file is not MP3/WAV, or file is corrupted."
@@ -153,8 +170,16 @@ func (h *Handlers) CalculateCapacityHandler(c *gin.Context) {
 		return
 	}
 
+	chipRate := 0 // default chip rate
+	if chipRateStr := c.PostForm("chip_rate"); chipRateStr != "" {
+		if chipRate, err = strconv.Atoi(chipRateStr); err != nil || !models.IsValidChipRate(chipRate) {
+			sendError(c, http.StatusBadRequest, "INVALID_DSSS_PARAMS", models.ErrInvalidDSSSParams.Error())
+			return
+		}
+	}
+
 	// Calculate capacity using steganography service
-	capacities, err := h.steganographyService.CalculateCapacity(audioData)
+	capacities, err := h.steganographyService.CalculateCapacity(audioData, chipRate)
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to calculate capacity")
 		return
@@ -170,11 +195,57 @@ func (h *Handlers) CalculateCapacityHandler(c *gin.Context) {
 		Channels:        2,     // Placeholder
 	}
 
+	// Optional secret: report its compressed size and the methods it fits
+	var secretFit *SecretFit
+	if secretHeader, err := c.FormFile("secret"); err == nil {
+		secretFile, err := secretHeader.Open()
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to open uploaded secret file")
+			return
+		}
+		defer secretFile.Close()
+		secretData, err := io.ReadAll(secretFile)
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to read secret file content")
+			return
+		}
+
+		// every method with its default options: no stego key and its default ECC level
+		fits := make(map[string]bool)
+		pcmData, pcmErr := h.steganographyService.DecodeToWAV(audioData)
+		for _, method := range models.GetSupportedMethods() {
+			req := models.EmbedRequest{CoverAudio: audioData, SecretFileName: secretHeader.Filename, Method: method, NLsb: 1, ECC: method.DefaultECC(),
+				DSSS: &models.DSSSParams{ChipRate: capacities.ChipRate, Gain: models.DefaultDSSSParams().Gain}}
+			if method.IsSignalDomain() {
+				if pcmErr != nil {
+					fits[method.String()] = false
+					continue
+				}
+				req.CoverAudio = pcmData // decoded once for all of them
+			}
+			if method == models.MethodLSB {
+				for n := 1; n <= 4; n++ {
+					req.NLsb = n
+					fits[fmt.Sprintf("%d_lsb", n)], _ = h.steganographyService.SecretFits(&req, secretData)
+				}
+				continue
+			}
+			fits[method.String()], _ = h.steganographyService.SecretFits(&req, secretData)
+		}
+		secretFit = &SecretFit{
+			Filename:            secretHeader.Filename,
+			SizeBytes:           len(secretData),
+			CompressedSizeBytes: h.steganographyService.EstimateSecretSize(secretData),
+			Fits:                fits,
+		}
+	}
+
 	processingTime := int(time.Since(startTime).Milliseconds())
 
 	response := CapacityResponse{
 		Capacities:       *capacities,
 		FileInfo:         fileInfo,
+		Secret:           secretFit,
 		ProcessingTimeMs: processingTime,
 	}
 
@@ -182,21 +253,51 @@ func (h *Handlers) CalculateCapacityHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// EmbedHandler embeds a secret file into an audio file using LSB or Parity steganography
+// EmbedHandler embeds a secret file into an audio file using LSB, Parity, Bitstream, LSB matching, Echo, Phase, DSSS, QIM or DCT steganography
 // @Summary      Embed secret file into audio
-// @Description  Embeds a secret file into the provided audio file using LSB or Parity steganography method. LSB method supports 1-4 LSBs, while Parity method uses 1 bit per byte. Supports optional Vigenère encryption and random embedding start using a stego key. Metadata (filename, format, size, method, flags) is automatically stored inside the stego file.
+// @Description  Embeds one or more secret files into a cover audio file (MP3 or 16-bit PCM WAV) and returns the stego audio.
+// @Description  Methods:
+// @Description  - lsb: 1-4 least significant bits of every carrier byte.
+// @Description  - parity: 1 bit per carrier byte, stored in the parity of its LSB.
+// @Description  - bitstream: MP3 only, 1 bit in the global_gain of every granule; the stego MP3 stays decodable.
+// @Description  - lsb_matching: 1 bit per carrier byte, changed by a random ±1 so no pairs-of-values artefact is left.
+// @Description  - echo: 1 bit per 2048 samples as a pair of faint echoes read from the cepstrum; needs ecc 'medium' or 'high'.
+// @Description  - phase: 1 bit per frequency bin of a mid band in the phase of the first loud 65536-sample segment; later segments are rotated along to keep their phase differences.
+// @Description  - dsss: 1 bit per chip_rate samples as pseudo-noise keyed with the stego key; read back after added noise or a start delay of up to 4096 samples.
+// @Description  - qim: 1 bit per sample, quantized onto one of two lattices dithered with the stego key.
+// @Description  - dct: 1 bit per mid-frequency DCT coefficient, 128 per 1024-sample block and channel.
+// @Description
+// @Description  Echo, phase, dsss, qim and dct work on the decoded audio and always return WAV; the other methods keep the format of the cover.
+// @Description  The PSNR and SNR against the cover are returned in the X-PSNR-Value and X-SNR-Value headers.
+// @Description  Secrets are compressed, optionally encrypted, and packed with their names, sizes and modification times into a container inside the stego file.
 // @Tags         Steganography
 // @Accept       multipart/form-data
-// @Produce      audio/mpeg
-// @Param        audio            formData  file   true  "Cover audio file (MP3)"
-// @Param        secret           formData  file   true  "Secret file to embed"
-// @Param        method           formData  string true  "Steganography method: 'lsb' or 'parity'"
+// @Produce      audio/mpeg,audio/wav
+// @Param        audio            formData  file   true  "Cover audio file (MP3 or 16-bit PCM WAV)"
+// @Param        secret           formData  file   true  "Secret file to embed; repeat the field to embed several files together"
+// @Param        secret_mtime     formData  int    false "Modification time (unix seconds) of each secret file, repeated in upload order; defaults to the upload time"
+// @Param        method           formData  string true  "Steganography method, see the list above" Enums(lsb, parity, bitstream, lsb_matching, echo, phase, dsss, qim, dct)
 // @Param        lsb              formData  int    false "Number of LSBs to use (1-4), required only for LSB method"
-// @Param        stego_key        formData  string false "Key for encryption and/or random start"
-// @Param        use_encryption   formData  bool   false "Enable Vigenère encryption"
+// @Param        stego_key        formData  string false "Key for encryption, random start and/or scatter"
+// @Param        use_encryption   formData  bool   false "Enable encryption of the secret"
+// @Param        cipher           formData  string false "Cipher used when encryption is enabled: 'vigenere' (extended 256-symbol Vigenère, default) or 'aes-gcm' (AES-256-GCM)"
+// @Param        recipient        formData  string false "Recipient public key ('astego-pub-...'); repeat the field for several recipients. The secret is then encrypted with AES-256-GCM under a random file key that only their private keys can unwrap, no stego key is needed"
+// @Param        recipients_file  formData  file   false "Text file with recipient public keys, one per line; repeat the field for several files"
+// @Param        signing_key      formData  string false "Signing key ('ASTEGO-SIGNING-KEY-...') from /keys with type 'signing'; the container is signed with Ed25519 so recipients can verify the sender"
+// @Param        signing_key_file formData  file   false "Key file holding the signing key, as downloaded from /keys; used when signing_key is not given"
 // @Param        use_random_start formData  bool   false "Enable random start embedding"
+// @Param        use_scatter      formData  bool   false "Scatter the payload bits over the whole cover with a key-driven permutation (overrides random start)"
+// @Param        kdf_time         formData  int    false "Argon2id passes used to derive keys from the stego key (1-4, default 3)"
+// @Param        kdf_memory       formData  int    false "Argon2id memory cost in MiB (8-256, default 64)"
+// @Param        kdf_threads      formData  int    false "Argon2id parallelism (1-16, default 4)"
+// @Param        public_header    formData  bool   false "Keep the KDF cost and container header readable without the key (by default they are hidden when a stego key is given)"
+// @Param        ecc              formData  string false "Reed–Solomon error correction: 'none', 'low', 'medium' or 'high' (16, 32 or 64 parity bytes per 255-byte block). Defaults to 'high' for the methods that work on the decoded audio and 'none' otherwise; echo needs at least 'medium'"
+// @Param        decode_to_pcm    formData  bool   false "Decode an MP3 cover and embed into its samples; the stego file is then WAV. Always done by the methods that work on the decoded audio"
+// @Param        chip_rate        formData  int    false "DSSS method only: samples spreading one bit, a power of two from 256 to 16384 (default 2048); more chips survive more distortion but lower the capacity"
+// @Param        gain             formData  number false "DSSS method only: amplitude of the chips relative to the RMS of the music, above 0 and at most 1 (default 0.05)"
+// @Param        qim_step         formData  int    false "QIM method only: quantization step in sample units, a power of two from 2 to 1024 (default 64); a larger step survives more distortion but changes every sample by up to half a step"
 // @Param        output_filename  formData  string false "Output stego audio filename"
-// @Success      200  {file}  binary  "Stego audio file with embedded secret"
+// @Success      200  {file}  binary  "Stego audio file with embedded secret (same format as the cover, or WAV when decode_to_pcm is set)"
 // @Failure      400  {object}  models.ErrorResponse "Invalid input"
 // @Failure      500  {object}  models.ErrorResponse "Processing error"
 // @Router       /embed [post]
@@ -213,85 +314,37 @@ func (h *Handlers) EmbedHandler(c *gin.Context) {
 	defer audioFile.Close()
 	audioData, _ := io.ReadAll(audioFile)
 
-	// === Ambil file secret ===
-	secretHeader, err := c.FormFile("secret")
-	if err != nil {
-		sendError(c, http.StatusBadRequest, "MISSING_FILES", "Secret file not provided")
+	// === Ambil file secret dan parameter ===
+	embedReq, ok := h.parseEmbedRequest(c, startTime)
+	if !ok {
 		return
 	}
-	secretFile, _ := secretHeader.Open()
-	defer secretFile.Close()
-	secretData, _ := io.ReadAll(secretFile)
-
-	// === Ambil parameter ===
-	methodStr := c.PostForm("method")
-	method := models.SteganographyMethod(methodStr)
-	if !method.IsValid() {
-		sendMethodError(c, fmt.Sprintf("Invalid steganography method '%s'. Please specify 'lsb' or 'parity'", methodStr))
-		return
-	}
-
-	lsb := 1 // Default for parity method
-	if method == models.MethodLSB {
-		lsbStr := c.PostForm("lsb")
-		if lsbStr == "" {
-			sendError(c, http.StatusBadRequest, "MISSING_LSB", "LSB value is required for LSB method")
-			return
-		}
-		var err error
-		lsb, err = strconv.Atoi(lsbStr)
-		if err != nil || lsb < 1 || lsb > 4 {
-			sendError(c, http.StatusBadRequest, "INVALID_LSB", "LSB value must be between 1 and 4")
-			return
-		}
-	}
-
-	stegoKey := c.PostForm("stego_key")
-	useEncryption := c.PostForm("use_encryption") == "true"
-	useRandomStart := c.PostForm("use_random_start") == "true"
-
-	if (useEncryption || useRandomStart) && stegoKey == "" {
-		sendError(c, http.StatusBadRequest, "INVALID_STEGO_KEY", "Stego key is required when encryption or random start is enabled")
-		return
-	}
-
-	embedReq := &models.EmbedRequest{
-		CoverAudio:     audioData,
-		SecretFile:     secretData,
-		SecretFileName: secretHeader.Filename,
-		StegoKey:       stegoKey,
-		Method:         method,
-		NLsb:           lsb,
-		UseEncryption:  useEncryption,
-		UseRandomStart: useRandomStart,
-	}
+	embedReq.CoverAudio = audioData
+	secretData := embedReq.SecretFile
+	method, lsb, eccLevel := embedReq.Method, embedReq.NLsb, embedReq.ECC
 
 	// === Embed melalui service ===
-	stegoAudio, psnr, err := h.steganographyService.EmbedMessage(embedReq, secretData, nil)
+	stegoAudio, distortion, err := h.steganographyService.EmbedMessage(embedReq, secretData, nil)
 	if err != nil {
 		// Provide more specific error messages based on error type
 		if err == models.ErrInsufficientCapacity {
-			// Calculate capacity to show in error
-			capacity, capacityErr := h.steganographyService.CalculateCapacity(audioData)
-			if capacityErr == nil {
-				var availableCapacity int
-				if method == models.MethodLSB {
-					switch lsb {
-					case 1:
-						availableCapacity = capacity.OneLSB
-					case 2:
-						availableCapacity = capacity.TwoLSB
-					case 3:
-						availableCapacity = capacity.ThreeLSB
-					case 4:
-						availableCapacity = capacity.FourLSB
-					}
-				} else {
-					availableCapacity = capacity.Parity
+			// Calculate capacity to show in error (against the decoded PCM when the cover was decoded)
+			capacityAudio := audioData
+			if embedReq.DecodeToPCM {
+				if decoded, decodeErr := h.steganographyService.DecodeToWAV(audioData); decodeErr == nil {
+					capacityAudio = decoded
 				}
+			}
+			chipRate := 0
+			if embedReq.DSSS != nil {
+				chipRate = embedReq.DSSS.ChipRate
+			}
+			capacity, capacityErr := h.steganographyService.CalculateCapacity(capacityAudio, chipRate)
+			if capacityErr == nil {
+				availableCapacity := methodCapacity(capacity, method, lsb, eccLevel)
 				sendError(c, http.StatusBadRequest, "INSUFFICIENT_CAPACITY",
-					fmt.Sprintf("Secret file size (%d bytes) exceeds available capacity (%d bytes) for %s method",
-						len(secretData), availableCapacity, method))
+					fmt.Sprintf("Secret file size (%d bytes, %d bytes compressed) exceeds available capacity (%d bytes) for %s method",
+						len(secretData), h.steganographyService.EstimateSecretSize(secretData), availableCapacity, method))
 				return
 			}
 		}
@@ -300,38 +353,59 @@ func (h *Handlers) EmbedHandler(c *gin.Context) {
 	}
 
 	processingTime := int(time.Since(startTime).Milliseconds())
+
+	// Stego audio keeps the container format of the cover (MP3 or WAV)
+	outputFormat := h.audioService.DetectFormat(stegoAudio)
 	outputFilename := c.PostForm("output_filename")
 	if outputFilename == "" {
-		outputFilename = "stego_audio.mp3"
+		outputFilename = "stego_audio" + outputFormat.Extension()
 	}
 
 	// === Set header response ===
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", outputFilename))
-	c.Header("X-PSNR-Value", fmt.Sprintf("%.2f", psnr))
-	if method == models.MethodLSB {
-		c.Header("X-Embedding-Method", fmt.Sprintf("%d-LSB", lsb))
-	} else {
-		c.Header("X-Embedding-Method", "Parity")
-	}
+	c.Header("X-PSNR-Value", fmt.Sprintf("%.2f", distortion.PSNR))
+	c.Header("X-SNR-Value", fmt.Sprintf("%.2f", distortion.SNR))
+	c.Header("X-Embedding-Method", embeddingMethodName(method, lsb))
 	c.Header("X-Secret-Size", strconv.Itoa(len(secretData)))
 	c.Header("X-Processing-Time", strconv.Itoa(processingTime))
-	c.Header("X-Output-Format", "MP3")
+	c.Header("X-Output-Format", strings.ToUpper(string(outputFormat)))
+	if embedReq.DSSS != nil {
+		c.Header("X-Chip-Rate", strconv.Itoa(embedReq.DSSS.ChipRate))
+		c.Header("X-Gain", strconv.FormatFloat(embedReq.DSSS.Gain, 'g', -1, 64))
+	}
+	if embedReq.QIMStep > 0 {
+		c.Header("X-QIM-Step", strconv.Itoa(embedReq.QIMStep))
+	}
 
-	c.Data(http.StatusOK, "audio/mpeg", stegoAudio)
+	c.Data(http.StatusOK, outputFormat.MimeType(), stegoAudio)
 }
 
-// ExtractHandler extracts a secret file from an audio file using LSB or Parity steganography
+// ExtractHandler extracts a secret file from an audio file using LSB, Parity, Bitstream, LSB matching, Echo, Phase, DSSS, QIM or DCT steganography
 // @Summary      Extract secret file from audio
-// @Description  Extracts a secret file that was previously embedded in an audio file using LSB or Parity steganography. Auto-detects the method used during embedding. Supports optional Vigenère decryption and random start. Automatically restores original filename and metadata.
+// @Description  Extracts the secret files embedded by /embed, detecting the method unless one is given.
+// @Description  The cipher and all other embedding options are read from the container; only keys have to be supplied.
+// @Description  The signature is reported in X-Signature-Status ('verified', 'untrusted', 'invalid' or 'unsigned') and the signer in X-Signer.
+// @Description  A wrong key and tampered data are reported separately, since every container carries an integrity tag.
+// @Description  Multi-file payloads are returned as a ZIP or tar archive; for stego files from /embed/deniable the key selects the layer.
+// @Description  Stego files with the older v2 header are still supported.
 // @Tags         Steganography
 // @Accept       multipart/form-data
-// @Produce      application/octet-stream
-// @Param        stego_audio      formData  file   true  "Stego audio file (MP3 with embedded data)"
-// @Param        method           formData  string false "Optional: specify method ('lsb' or 'parity') to speed up extraction"
-// @Param        stego_key        formData  string false "Key for decryption and/or random start"
+// @Produce      application/octet-stream,application/zip,application/x-tar
+// @Param        stego_audio      formData  file   true  "Stego audio file (MP3 or WAV with embedded data)"
+// @Param        method           formData  string false "Method used at embedding; speeds up extraction, auto-detected when empty" Enums(lsb, parity, bitstream, lsb_matching, echo, phase, dsss, qim, dct)
+// @Param        stego_key        formData  string false "Key for decryption, random start and/or scatter"
+// @Param        identity         formData  string false "Private key ('ASTEGO-SECRET-KEY-...') for secrets encrypted to recipients; repeat the field for several keys"
+// @Param        identity_file    formData  file   false "Identity file with private keys, one per line, as downloaded from /keys; repeat the field for several files"
+// @Param        trusted_signer   formData  string false "Public key ('astego-signer-...') of a trusted sender; repeat the field for several senders. A valid signature by one of them is reported as 'verified'"
+// @Param        signers_file     formData  file   false "Text file with trusted signer public keys, one per line; repeat the field for several files"
+// @Param        kdf_time         formData  int    false "Argon2id passes used at embedding, only needed for hidden headers with non-default cost"
+// @Param        kdf_memory       formData  int    false "Argon2id memory cost in MiB used at embedding, only needed for hidden headers with non-default cost"
+// @Param        kdf_threads      formData  int    false "Argon2id parallelism used at embedding, only needed for hidden headers with non-default cost"
+// @Param        archive          formData  string false "Archive format for multi-file payloads: 'zip' (default) or 'tar'"
 // @Param        output_filename  formData  string false "Optional output filename override"
-// @Success      200  {file}  binary  "Extracted secret file"
-// @Failure      400  {object}  models.ErrorResponse "Invalid input"
+// @Success      200  {file}  binary  "Extracted secret file, or a ZIP/tar archive of all files for multi-file payloads"
+// @Failure      400  {object}  models.ErrorResponse "Invalid input, wrong stego key or no matching private key"
+// @Failure      422  {object}  models.ErrorResponse "Integrity check failed, the embedded data was modified"
 // @Failure      500  {object}  models.ErrorResponse "Extraction error"
 // @Router       /extract [post]
 func (h *Handlers) ExtractHandler(c *gin.Context) {
@@ -347,44 +421,505 @@ func (h *Handlers) ExtractHandler(c *gin.Context) {
 	defer stegoFile.Close()
 	stegoData, _ := io.ReadAll(stegoFile)
 
+	extractReq, archiveFormat, ok := h.parseExtractRequest(c)
+	if !ok {
+		return
+	}
+	extractReq.StegoAudio = stegoData
+
+	result, err := h.steganographyService.ExtractContainer(extractReq, stegoData)
+	if err != nil {
+		sendExtractionError(c, err)
+		return
+	}
+
+	serveExtractedSecret(c, result, archiveFormat, extractReq.OutputFilename, startTime)
+}
+
+// serveExtractedSecret writes an extracted secret with its metadata headers. The secret is served
+// with the MIME type recorded at embedding when there is one, multi-file payloads as an archive
+// of all entries.
+func serveExtractedSecret(c *gin.Context, result *models.ExtractResponse, archiveFormat models.ArchiveFormat, outputFilename string, startTime time.Time) {
+	secretData := result.SecretData
+	contentType := "application/octet-stream"
+	if result.MimeType != "" {
+		contentType = result.MimeType
+	}
+	if len(result.Entries) > 0 {
+		var err error
+		secretData, err = buildArchive(archiveFormat, result.Entries)
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to build archive: "+err.Error())
+			return
+		}
+		contentType = archiveFormat.MimeType()
+		result.Filename += archiveFormat.Extension()
+		c.Header("X-Archive-Entries", strconv.Itoa(len(result.Entries)))
+	}
+
+	processingTime := int(time.Since(startTime).Milliseconds())
+	if outputFilename == "" {
+		outputFilename = result.Filename
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", outputFilename))
+	c.Header("X-Extraction-Method", "Auto-detected")
+	c.Header("X-Secret-Size", strconv.Itoa(len(secretData)))
+	c.Header("X-Processing-Time", strconv.Itoa(processingTime))
+	c.Header("X-Format-Version", strconv.Itoa(result.FormatVersion))
+	if result.OriginalSize > 0 {
+		c.Header("X-Original-Size", strconv.FormatInt(result.OriginalSize, 10))
+	}
+	if result.EmbeddedAt != nil {
+		c.Header("X-Embedded-At", result.EmbeddedAt.Format(time.RFC3339))
+	}
+	c.Header("X-Signature-Status", string(result.Signature.Status))
+	if result.Signature.Signer != "" {
+		c.Header("X-Signer", result.Signature.Signer)
+	}
+	if result.ChipRate > 0 {
+		c.Header("X-Chip-Rate", strconv.Itoa(result.ChipRate))
+	}
+	if result.Gain > 0 {
+		c.Header("X-Gain", strconv.FormatFloat(result.Gain, 'g', -1, 64))
+	}
+	if result.QIMStep > 0 {
+		c.Header("X-QIM-Step", strconv.Itoa(result.QIMStep))
+	}
+
+	c.Data(http.StatusOK, contentType, secretData)
+}
+
+// sendExtractionError reports a failed extraction, telling a wrong key apart from data that was
+// modified after embedding
+func sendExtractionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidStegoKey):
+		sendError(c, http.StatusBadRequest, "INVALID_STEGO_KEY", "Failed to extract data: "+err.Error())
+	case errors.Is(err, models.ErrIntegrityFailed):
+		sendError(c, http.StatusUnprocessableEntity, "INTEGRITY_FAILED", "Failed to extract data: "+err.Error())
+	case errors.Is(err, models.ErrShardedSecret):
+		sendError(c, http.StatusBadRequest, "SHARDED_SECRET", "Failed to extract data: "+err.Error())
+	case errors.Is(err, models.ErrShardSetMismatch):
+		sendError(c, http.StatusBadRequest, "SHARD_SET_MISMATCH", "Failed to extract data: "+err.Error())
+	case errors.Is(err, models.ErrNoMatchingIdentity):
+		sendError(c, http.StatusBadRequest, "NO_MATCHING_IDENTITY", "Failed to extract data: "+err.Error())
+	case errors.Is(err, models.ErrSecretShare):
+		sendError(c, http.StatusBadRequest, "SECRET_SHARE", "Failed to extract data: "+err.Error())
+	case errors.Is(err, models.ErrShareSetMismatch):
+		sendError(c, http.StatusBadRequest, "SHARE_SET_MISMATCH", "Failed to extract data: "+err.Error())
+	default:
+		sendError(c, http.StatusInternalServerError, "EXTRACTION_ERROR", "Failed to extract data: "+err.Error())
+	}
+}
+
+// parseEmbedRequest reads the secret file(s) and the embedding options shared by /embed,
+// /embed/shards and /embed/shares. The cover is left for the caller. ok is false if an error
+// response was sent.
+func (h *Handlers) parseEmbedRequest(c *gin.Context, startTime time.Time) (*models.EmbedRequest, bool) {
+	// === Ambil file secret ===
+	secret, ok := readSecret(c, "secret", "secret_mtime", startTime)
+	if !ok {
+		return nil, false
+	}
+
+	// === Ambil parameter ===
+	methodStr := c.PostForm("method")
+	method := models.SteganographyMethod(methodStr)
+	if !method.IsValid() {
+		sendMethodError(c, fmt.Sprintf("Invalid steganography method '%s'. Please specify %s", methodStr, models.MethodList()))
+		return nil, false
+	}
+
+	lsb := 1 // Default for parity and bitstream methods
+	if method == models.MethodLSB {
+		lsbStr := c.PostForm("lsb")
+		if lsbStr == "" {
+			sendError(c, http.StatusBadRequest, "MISSING_LSB", "LSB value is required for LSB method")
+			return nil, false
+		}
+		var err error
+		lsb, err = strconv.Atoi(lsbStr)
+		if err != nil || lsb < 1 || lsb > 4 {
+			sendError(c, http.StatusBadRequest, "INVALID_LSB", "LSB value must be between 1 and 4")
+			return nil, false
+		}
+	}
+
 	stegoKey := c.PostForm("stego_key")
-	outputFilename := c.PostForm("output_filename")
+	useEncryption := c.PostForm("use_encryption") == "true"
+	useRandomStart := c.PostForm("use_random_start") == "true"
+	useScatter := c.PostForm("use_scatter") == "true"
+	publicHeader := c.PostForm("public_header") == "true"
+	decodeToPCM := c.PostForm("decode_to_pcm") == "true"
+
+	// Recipient public keys, given as text or uploaded key files
+	recipients, err := h.readKeys(c, "recipient", "recipients_file", h.cryptographyService.ParseRecipients)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "INVALID_RECIPIENT", "Failed to read recipient keys: "+err.Error())
+		return nil, false
+	}
+
+	// Optional signing key, given as text or as an uploaded key file
+	signingKey, err := h.readSigningKey(c)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "INVALID_SIGNING_KEY", "Failed to read signing key: "+err.Error())
+		return nil, false
+	}
+
+	// Encryption to recipients does not need a stego key
+	if ((useEncryption && len(recipients) == 0) || useRandomStart || useScatter) && stegoKey == "" {
+		sendError(c, http.StatusBadRequest, "INVALID_STEGO_KEY", "Stego key is required when encryption, random start or scatter is enabled")
+		return nil, false
+	}
+
+	cipherType := models.CipherVigenere
+	if cipherStr := c.PostForm("cipher"); cipherStr != "" {
+		cipherType = models.CipherType(cipherStr)
+		if !cipherType.IsValid() {
+			sendError(c, http.StatusBadRequest, "INVALID_CIPHER", fmt.Sprintf("Invalid cipher '%s'. Please specify 'vigenere' or 'aes-gcm'", cipherStr))
+			return nil, false
+		}
+	}
+
+	kdfParams, ok := parseKDFParams(c)
+	if !ok {
+		sendError(c, http.StatusBadRequest, "INVALID_KDF_PARAMS", models.ErrInvalidKDFParams.Error())
+		return nil, false
+	}
+
+	var dsssParams *models.DSSSParams
+	if method == models.MethodDSSS {
+		if dsssParams, ok = parseDSSSParams(c); !ok {
+			sendError(c, http.StatusBadRequest, "INVALID_DSSS_PARAMS", models.ErrInvalidDSSSParams.Error())
+			return nil, false
+		}
+	}
+
+	qimStep := 0
+	if method == models.MethodQIM {
+		qimStep = models.DefaultQIMStep
+		if qimStepStr := c.PostForm("qim_step"); qimStepStr != "" {
+			if qimStep, err = strconv.Atoi(qimStepStr); err != nil || !models.IsValidQIMStep(qimStep) {
+				sendError(c, http.StatusBadRequest, "INVALID_QIM_STEP", models.ErrInvalidQIMStep.Error())
+				return nil, false
+			}
+		}
+	}
 
+	eccLevel := models.ECCLevel(c.PostForm("ecc"))
+	if eccLevel == "" {
+		eccLevel = method.DefaultECC()
+	}
+	if !eccLevel.IsValid() {
+		sendError(c, http.StatusBadRequest, "INVALID_ECC_LEVEL", models.ErrInvalidECCLevel.Error())
+		return nil, false
+	}
+	if !eccLevel.Covers(method.MinECC()) {
+		sendError(c, http.StatusBadRequest, "INVALID_ECC_LEVEL", models.ErrECCTooLow.Error())
+		return nil, false
+	}
+
+	return &models.EmbedRequest{
+		SecretFile:     secret.SecretFile,
+		SecretFileName: secret.SecretFileName,
+		SecretMimeType: secret.SecretMimeType,
+		SecretEntries:  secret.SecretEntries,
+		StegoKey:       stegoKey,
+		Method:         method,
+		NLsb:           lsb,
+		UseEncryption:  useEncryption,
+		Cipher:         cipherType,
+		UseRandomStart: useRandomStart,
+		UseScatter:     useScatter,
+		KDF:            kdfParams,
+		PublicHeader:   publicHeader,
+		ECC:            eccLevel,
+		DecodeToPCM:    decodeToPCM,
+		Recipients:     recipients,
+		SigningKey:     signingKey,
+		DSSS:           dsssParams,
+		QIMStep:        qimStep,
+	}, true
+}
+
+// readSecret reads the secret file uploaded in field; several files in the repeated field are
+// embedded together with a directory, with the modification times given in mtimeField. Only the
+// secret fields of the returned request are set. ok is false if an error response was sent.
+func readSecret(c *gin.Context, field, mtimeField string, startTime time.Time) (*models.EmbedRequest, bool) {
+	secretHeader, err := c.FormFile(field)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "MISSING_FILES", "Secret file not provided")
+		return nil, false
+	}
+	secretFile, _ := secretHeader.Open()
+	defer secretFile.Close()
+	secretData, _ := io.ReadAll(secretFile)
+
+	// === Several secret files are embedded together with a directory ===
+	secret := &models.EmbedRequest{
+		SecretFile:     secretData,
+		SecretFileName: secretHeader.Filename,
+		SecretMimeType: secretHeader.Header.Get("Content-Type"),
+	}
+	if form, err := c.MultipartForm(); err == nil && len(form.File[field]) > 1 {
+		entries, err := readSecretEntries(form.File[field], form.Value[mtimeField], startTime)
+		if err != nil {
+			sendError(c, http.StatusBadRequest, "INVALID_SECRET", "Failed to read secret files: "+err.Error())
+			return nil, false
+		}
+		secret = &models.EmbedRequest{SecretEntries: entries}
+		for _, e := range entries {
+			secret.SecretFile = append(secret.SecretFile, e.Data...)
+		}
+	}
+	return secret, true
+}
+
+// parseExtractRequest reads the extraction options shared by /extract, /extract/shards and
+// /extract/shares together with the archive format for multi-file payloads. ok is false if an
+// error response was sent.
+func (h *Handlers) parseExtractRequest(c *gin.Context) (*models.ExtractRequest, models.ArchiveFormat, bool) {
 	// Optional method parameter for faster extraction
 	methodStr := c.PostForm("method")
 	var method models.SteganographyMethod
 	if methodStr != "" {
 		method = models.SteganographyMethod(methodStr)
 		if !method.IsValid() {
-			sendMethodError(c, fmt.Sprintf("Invalid steganography method '%s'. Leave empty for auto-detection or specify 'lsb' or 'parity'", methodStr))
-			return
+			sendMethodError(c, fmt.Sprintf("Invalid steganography method '%s'. Leave empty for auto-detection or specify %s", methodStr, models.MethodList()))
+			return nil, "", false
 		}
 	}
 
-	extractReq := &models.ExtractRequest{
-		StegoAudio:     stegoData,
+	kdfParams, ok := parseKDFParams(c)
+	if !ok {
+		sendError(c, http.StatusBadRequest, "INVALID_KDF_PARAMS", models.ErrInvalidKDFParams.Error())
+		return nil, "", false
+	}
+
+	archiveFormat, ok := parseArchiveFormat(c)
+	if !ok {
+		return nil, "", false
+	}
+
+	// Private keys for secrets encrypted to recipients, given as text or uploaded identity files
+	identities, err := h.readKeys(c, "identity", "identity_file", h.cryptographyService.ParseIdentities)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "INVALID_IDENTITY", "Failed to read private keys: "+err.Error())
+		return nil, "", false
+	}
+
+	// Public keys of the senders whose signatures are trusted
+	trustedSigners, err := h.readKeys(c, "trusted_signer", "signers_file", h.cryptographyService.ParseSigners)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "INVALID_SIGNER", "Failed to read trusted signers: "+err.Error())
+		return nil, "", false
+	}
+
+	return &models.ExtractRequest{
 		Method:         method, // Empty string means auto-detect
-		StegoKey:       stegoKey,
-		OutputFilename: outputFilename,
+		StegoKey:       c.PostForm("stego_key"),
+		KDF:            kdfParams,
+		Identities:     identities,
+		TrustedSigners: trustedSigners,
+		OutputFilename: c.PostForm("output_filename"),
+	}, archiveFormat, true
+}
+
+// readKeys collects the keys given in the repeated text field and in the uploaded key files of
+// fileField, parsed with parse. No keys at all is not an error.
+func (h *Handlers) readKeys(c *gin.Context, field, fileField string, parse func([]byte) ([][]byte, error)) ([][]byte, error) {
+	var keys [][]byte
+	for _, text := range c.PostFormArray(field) {
+		parsed, err := parse([]byte(text))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, parsed...)
+	}
+	if form, err := c.MultipartForm(); err == nil && len(form.File[fileField]) > 0 {
+		files, err := readFormFiles(form.File[fileField])
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range files {
+			parsed, err := parse(data)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, parsed...)
+		}
 	}
+	return keys, nil
+}
 
-	secretData, filename, err := h.steganographyService.ExtractMessage(extractReq, stegoData)
+// readSigningKey reads the signing key from the signing_key field or else the signing_key_file
+// upload. No key is not an error.
+func (h *Handlers) readSigningKey(c *gin.Context) ([]byte, error) {
+	if text := c.PostForm("signing_key"); text != "" {
+		return h.cryptographyService.ParseSigningKey([]byte(text))
+	}
+	keyHeader, err := c.FormFile("signing_key_file")
 	if err != nil {
-		sendError(c, http.StatusInternalServerError, "EXTRACTION_ERROR", "Failed to extract data: "+err.Error())
-		return
+		return nil, nil
 	}
+	files, err := readFormFiles([]*multipart.FileHeader{keyHeader})
+	if err != nil {
+		return nil, err
+	}
+	return h.cryptographyService.ParseSigningKey(files[0])
+}
 
-	processingTime := int(time.Since(startTime).Milliseconds())
-	if outputFilename == "" {
-		outputFilename = filename
+// parseArchiveFormat reads the optional archive field (zip by default). ok is false if an error
+// response was sent.
+func parseArchiveFormat(c *gin.Context) (models.ArchiveFormat, bool) {
+	archiveFormat := models.ArchiveZIP
+	if archiveStr := c.PostForm("archive"); archiveStr != "" {
+		archiveFormat = models.ArchiveFormat(archiveStr)
+		if !archiveFormat.IsValid() {
+			sendError(c, http.StatusBadRequest, "INVALID_ARCHIVE_FORMAT", fmt.Sprintf("Invalid archive format '%s'. Please specify 'zip' or 'tar'", archiveStr))
+			return "", false
+		}
 	}
+	return archiveFormat, true
+}
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", outputFilename))
-	c.Header("X-Extraction-Method", "Auto-detected")
-	c.Header("X-Secret-Size", strconv.Itoa(len(secretData)))
-	c.Header("X-Processing-Time", strconv.Itoa(processingTime))
+// methodCapacity picks the capacity of the given method out of a capacity result. With ECC only
+// the effective capacity is available for the secret.
+func methodCapacity(capacity *models.CapacityResult, method models.SteganographyMethod, lsb int, eccLevel models.ECCLevel) int {
+	if effective, ok := capacity.ECC[eccLevel]; ok {
+		capacity = effective
+	}
+	if method == models.MethodLSB {
+		switch lsb {
+		case 1:
+			return capacity.OneLSB
+		case 2:
+			return capacity.TwoLSB
+		case 3:
+			return capacity.ThreeLSB
+		case 4:
+			return capacity.FourLSB
+		}
+	} else if method == models.MethodBitstream {
+		return capacity.Bitstream
+	} else if method == models.MethodLSBMatching {
+		return capacity.LSBMatching
+	} else if method == models.MethodEcho {
+		return capacity.Echo
+	} else if method == models.MethodPhase {
+		return capacity.Phase
+	} else if method == models.MethodDSSS {
+		return capacity.DSSS
+	} else if method == models.MethodQIM {
+		return capacity.QIM
+	} else if method == models.MethodDCT {
+		return capacity.DCT
+	}
+	return capacity.Parity
+}
+
+// embeddingMethodName returns the method label sent in the X-Embedding-Method header
+func embeddingMethodName(method models.SteganographyMethod, lsb int) string {
+	switch method {
+	case models.MethodLSB:
+		return fmt.Sprintf("%d-LSB", lsb)
+	case models.MethodBitstream:
+		return "Bitstream"
+	case models.MethodLSBMatching:
+		return "LSB-Matching"
+	case models.MethodEcho:
+		return "Echo"
+	case models.MethodPhase:
+		return "Phase"
+	case models.MethodDSSS:
+		return "DSSS"
+	case models.MethodQIM:
+		return "QIM"
+	case models.MethodDCT:
+		return "DCT"
+	default:
+		return "Parity"
+	}
+}
+
+// readSecretEntries reads the files of a multi-file secret. mtimes optionally holds the modification
+// time of each file in unix seconds, in upload order; files without one get defaultTime.
+func readSecretEntries(files []*multipart.FileHeader, mtimes []string, defaultTime time.Time) ([]models.SecretEntry, error) {
+	entries := make([]models.SecretEntry, 0, len(files))
+	for i, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		modTime := defaultTime
+		if i < len(mtimes) && mtimes[i] != "" {
+			seconds, err := strconv.ParseInt(mtimes[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret_mtime '%s'", mtimes[i])
+			}
+			modTime = time.Unix(seconds, 0)
+		}
+		entries = append(entries, models.SecretEntry{Name: fh.Filename, Size: len(data), ModTime: modTime, Data: data})
+	}
+	return entries, nil
+}
+
+// parseKDFParams reads the optional kdf_time, kdf_memory and kdf_threads form fields.
+// Missing fields keep their default value; ok is false if a field is malformed or out of range.
+func parseKDFParams(c *gin.Context) (*models.KDFParams, bool) {
+	timeStr, memoryStr, threadsStr := c.PostForm("kdf_time"), c.PostForm("kdf_memory"), c.PostForm("kdf_threads")
+	if timeStr == "" && memoryStr == "" && threadsStr == "" {
+		return nil, true
+	}
 
-	c.Data(http.StatusOK, "application/octet-stream", secretData)
+	params := models.DefaultKDFParams()
+	for _, field := range []struct {
+		value string
+		max   int
+		set   func(int)
+	}{
+		{timeStr, 0xFF, func(v int) { params.Time = uint8(v) }},
+		{memoryStr, 0xFFFF, func(v int) { params.MemoryMiB = uint16(v) }},
+		{threadsStr, 0xFF, func(v int) { params.Threads = uint8(v) }},
+	} {
+		if field.value == "" {
+			continue
+		}
+		v, err := strconv.Atoi(field.value)
+		if err != nil || v < 0 || v > field.max {
+			return nil, false
+		}
+		field.set(v)
+	}
+	return &params, params.IsValid()
+}
+
+// parseDSSSParams reads the chip_rate and gain fields of the DSSS method, falling back to the
+// defaults for fields that are not given. ok is false if a field is malformed or out of range.
+func parseDSSSParams(c *gin.Context) (*models.DSSSParams, bool) {
+	params := models.DefaultDSSSParams()
+	if chipRateStr := c.PostForm("chip_rate"); chipRateStr != "" {
+		chipRate, err := strconv.Atoi(chipRateStr)
+		if err != nil {
+			return nil, false
+		}
+		params.ChipRate = chipRate
+	}
+	if gainStr := c.PostForm("gain"); gainStr != "" {
+		gain, err := strconv.ParseFloat(gainStr, 64)
+		if err != nil {
+			return nil, false
+		}
+		params.Gain = gain
+	}
+	return &params, params.IsValid()
 }
 
 // sendError sends a standardized error response
@@ -406,18 +941,22 @@ func sendError(c *gin.Context, statusCode int, code string, message string) {
 
 // sendMethodError sends an error with information about supported methods
 func sendMethodError(c *gin.Context, message string) {
+	supportedMethods := []string{}
+	methodDescriptions := map[string]string{}
+	for _, m := range models.GetSupportedMethods() {
+		supportedMethods = append(supportedMethods, m.String())
+		methodDescriptions[m.String()] = m.Description()
+	}
+
 	errorResponse := models.ErrorResponse{
 		Success: false,
 		Error: models.ErrorDetail{
 			Message: message,
 			Details: map[string]interface{}{
-				"code":              "INVALID_METHOD",
-				"supported_methods": []string{"lsb", "parity"},
-				"method_descriptions": map[string]string{
-					"lsb":    "Least Significant Bit method (supports 1-4 LSBs)",
-					"parity": "Parity bit method (1 bit per byte, more robust)",
-				},
-				"timestamp": time.Now(),
+				"code":                "INVALID_METHOD",
+				"supported_methods":   supportedMethods,
+				"method_descriptions": methodDescriptions,
+				"timestamp":           time.Now(),
 			},
 		},
 	}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// GenerateKeyPairHandler creates a recipient or signing key pair
+// @Summary      Generate key pair
+// @Description  Generates a key pair; the server does not keep any key. A recipient key pair (X25519, the default) is used for public-key embedding: secrets embedded with the public key as a recipient can only be extracted with the private key, so no stego key has to be shared. Its public key is text starting with 'astego-pub-', its private key text starting with 'ASTEGO-SECRET-KEY-'. A signing key pair (Ed25519) signs embedded containers: the private key ('ASTEGO-SIGNING-KEY-...') is given as signing_key when embedding and the public key ('astego-signer-...') as trusted_signer when extracting. With download set, the private key is returned as a key file (the private key line preceded by comments with the creation time and the public key), which can be uploaded again as identity_file or signing_key_file.
+// @Tags         Keys
+// @Accept       multipart/form-data
+// @Produce      json,text/plain
+// @Param        type      formData  string  false "Key pair type: 'recipient' (X25519, default) or 'signing' (Ed25519)"
+// @Param        download  formData  bool    false "Return the key file as a download instead of JSON"
+// @Success      200  {object}  models.KeyPair "Generated key pair, or the key file when download is set"
+// @Failure      400  {object}  models.ErrorResponse "Invalid key type"
+// @Failure      500  {object}  models.ErrorResponse "Key generation error"
+// @Router       /keys [post]
+func (h *Handlers) GenerateKeyPairHandler(c *gin.Context) {
+	keyType := models.KeyType(c.PostForm("type"))
+	if !keyType.IsValid() {
+		sendError(c, http.StatusBadRequest, "INVALID_KEY_TYPE", fmt.Sprintf("Invalid key type '%s'. Please specify 'recipient' or 'signing'", keyType))
+		return
+	}
+
+	generate, filename := h.cryptographyService.GenerateKeyPair, "astego-key.txt"
+	if keyType == models.KeyTypeSigning {
+		generate, filename = h.cryptographyService.GenerateSigningKeyPair, "astego-signing-key.txt"
+	}
+	keyPair, err := generate()
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to generate key pair: "+err.Error())
+		return
+	}
+
+	if c.PostForm("download") == "true" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		c.Header("X-Public-Key", keyPair.PublicKey)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", keyPair.IdentityFile())
+		return
+	}
+	c.JSON(http.StatusOK, keyPair)
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// coverSet describes how a multi-cover route spreads one secret over several covers. Shard sets
+// and share sets only differ in these fields; form parsing, error mapping and archive assembly
+// are done by embedCoverSet.
+type coverSet struct {
+	kind        string // "shard" or "share": names the stego files <cover>_<kind><n> and the archive stego_<kind>s
+	capacity    string // what a secret that does not fit exceeds, %d is the number of covers
+	invalid     error  // rejection of the set parameters, by check or by split
+	invalidCode string
+	// check validates the set parameters of the form for the number of uploaded covers
+	check func(covers int) bool
+	// split embeds the secret of req across the covers and returns the stego files in cover order
+	// with their distortion and the response headers describing the set
+	split func(req *models.EmbedRequest, covers [][]byte) ([][]byte, []models.Distortion, map[string]string, error)
+}
+
+// embedCoverSet is the body of the handlers that embed one secret across several covers
+func (h *Handlers) embedCoverSet(c *gin.Context, set coverSet) {
+	startTime := time.Now()
+
+	// === Ambil file audio ===
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["audio"]) == 0 {
+		sendError(c, http.StatusBadRequest, "MISSING_FILES", "Audio files not provided")
+		return
+	}
+	coverHeaders := form.File["audio"]
+	if !set.check(len(coverHeaders)) {
+		sendError(c, http.StatusBadRequest, set.invalidCode, set.invalid.Error())
+		return
+	}
+	covers, err := readFormFiles(coverHeaders)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "MISSING_FILES", "Failed to read audio files: "+err.Error())
+		return
+	}
+
+	// === Ambil file secret dan parameter ===
+	embedReq, ok := h.parseEmbedRequest(c, startTime)
+	if !ok {
+		return
+	}
+	archiveFormat, ok := parseArchiveFormat(c)
+	if !ok {
+		return
+	}
+	secretData := embedReq.SecretFile
+
+	// === Embed melalui service ===
+	stegoFiles, distortions, headers, err := set.split(embedReq, covers)
+	if err != nil {
+		switch err {
+		case models.ErrInsufficientCapacity:
+			sendError(c, http.StatusBadRequest, "INSUFFICIENT_CAPACITY",
+				fmt.Sprintf("Secret file size (%d bytes, %d bytes compressed) exceeds %s for %s method",
+					len(secretData), h.steganographyService.EstimateSecretSize(secretData), fmt.Sprintf(set.capacity, len(covers)), embedReq.Method))
+		case set.invalid:
+			sendError(c, http.StatusBadRequest, set.invalidCode, err.Error())
+		default:
+			sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to embed data: "+err.Error())
+		}
+		return
+	}
+
+	// Every stego file is named after its cover and keeps the container format it was written in
+	entries := make([]models.SecretEntry, len(stegoFiles))
+	psnrValues := make([]string, len(distortions))
+	snrValues := make([]string, len(distortions))
+	for i, stego := range stegoFiles {
+		stem := strings.TrimSuffix(coverHeaders[i].Filename, filepath.Ext(coverHeaders[i].Filename))
+		name := fmt.Sprintf("%s_%s%d%s", stem, set.kind, i+1, h.audioService.DetectFormat(stego).Extension())
+		entries[i] = models.SecretEntry{Name: name, Size: len(stego), ModTime: startTime, Data: stego}
+		psnrValues[i] = fmt.Sprintf("%.2f", distortions[i].PSNR)
+		snrValues[i] = fmt.Sprintf("%.2f", distortions[i].SNR)
+	}
+	archive, err := buildArchive(archiveFormat, entries)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "PROCESSING_ERROR", "Failed to build archive: "+err.Error())
+		return
+	}
+
+	processingTime := int(time.Since(startTime).Milliseconds())
+	outputFilename := c.PostForm("output_filename")
+	if outputFilename == "" {
+		outputFilename = "stego_" + set.kind + "s" + archiveFormat.Extension()
+	}
+
+	// === Set header response ===
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", outputFilename))
+	c.Header("X-PSNR-Value", strings.Join(psnrValues, ","))
+	c.Header("X-SNR-Value", strings.Join(snrValues, ","))
+	c.Header("X-Embedding-Method", embeddingMethodName(embedReq.Method, embedReq.NLsb))
+	c.Header("X-Secret-Size", strconv.Itoa(len(secretData)))
+	for name, value := range headers {
+		c.Header(name, value)
+	}
+	c.Header("X-Processing-Time", strconv.Itoa(processingTime))
+
+	c.Data(http.StatusOK, archiveFormat.MimeType(), archive)
+}
+
+// extractCoverSet is the body of the handlers that recover one secret from several stego files.
+// combine recovers the secret and returns the response headers describing the set; a set with
+// parts missing is reported with an incompleteSetError.
+func (h *Handlers) extractCoverSet(c *gin.Context, combine func(req *models.ExtractRequest, stegoFiles [][]byte) (*models.ExtractResponse, map[string]string, error)) {
+	startTime := time.Now()
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["stego_audio"]) == 0 {
+		sendError(c, http.StatusBadRequest, "MISSING_FILE", "Stego audio files not provided")
+		return
+	}
+	stegoFiles, err := readFormFiles(form.File["stego_audio"])
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "MISSING_FILE", "Failed to read stego audio files: "+err.Error())
+		return
+	}
+
+	extractReq, archiveFormat, ok := h.parseExtractRequest(c)
+	if !ok {
+		return
+	}
+
+	result, headers, err := combine(extractReq, stegoFiles)
+	if err != nil {
+		var incomplete *incompleteSetError
+		if errors.As(err, &incomplete) {
+			sendIncompleteSetError(c, incomplete)
+			return
+		}
+		sendExtractionError(c, err)
+		return
+	}
+
+	for name, value := range headers {
+		c.Header(name, value)
+	}
+	serveExtractedSecret(c, result, archiveFormat, extractReq.OutputFilename, startTime)
+}
+
+// incompleteSetError reports a shard or share set with too few parts to recover the secret; its
+// details list what was found
+type incompleteSetError struct {
+	code    string
+	message string
+	details map[string]interface{}
+}
+
+func (e *incompleteSetError) Error() string {
+	return e.message
+}
+
+// sendIncompleteSetError sends an incomplete set with its details
+func sendIncompleteSetError(c *gin.Context, e *incompleteSetError) {
+	details := map[string]interface{}{"code": e.code, "timestamp": time.Now()}
+	for k, v := range e.details {
+		details[k] = v
+	}
+	c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+		Success: false,
+		Error:   models.ErrorDetail{Message: e.message, Details: details},
+	})
+}
+
+// readFormFiles reads the content of every uploaded file of a repeated form field
+func readFormFiles(files []*multipart.FileHeader) ([][]byte, error) {
+	out := make([][]byte, 0, len(files))
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data)
+	}
+	return out, nil
+}
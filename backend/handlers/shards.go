@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// EmbedShardsHandler splits a secret file across several cover files
+// @Summary      Split secret file across several audio files
+// @Description  Splits a secret too large for one cover across several covers, in proportion to their capacity.
+// @Description  Every cover gets a complete container with a shard record: a random set identifier, its sequence number and the shard count.
+// @Description  The stego files are returned in a ZIP or tar archive, in upload order.
+// @Description  The embedding options are those of /embed and apply to every shard.
+// @Tags         Steganography
+// @Accept       multipart/form-data
+// @Produce      application/zip,application/x-tar
+// @Param        audio            formData  file   true  "Cover audio files (MP3 or 16-bit PCM WAV); repeat the field once per cover, at least 2"
+// @Param        secret           formData  file   true  "See /embed"
+// @Param        secret_mtime     formData  int    false "See /embed"
+// @Param        method           formData  string true  "See /embed"
+// @Param        lsb              formData  int    false "See /embed"
+// @Param        stego_key        formData  string false "See /embed"
+// @Param        use_encryption   formData  bool   false "See /embed"
+// @Param        cipher           formData  string false "See /embed"
+// @Param        recipient        formData  string false "See /embed"
+// @Param        recipients_file  formData  file   false "See /embed"
+// @Param        signing_key      formData  string false "See /embed"
+// @Param        signing_key_file formData  file   false "See /embed"
+// @Param        use_random_start formData  bool   false "See /embed"
+// @Param        use_scatter      formData  bool   false "See /embed"
+// @Param        kdf_time         formData  int    false "See /embed"
+// @Param        kdf_memory       formData  int    false "See /embed"
+// @Param        kdf_threads      formData  int    false "See /embed"
+// @Param        public_header    formData  bool   false "See /embed"
+// @Param        ecc              formData  string false "See /embed"
+// @Param        decode_to_pcm    formData  bool   false "See /embed"
+// @Param        chip_rate        formData  int    false "See /embed"
+// @Param        gain             formData  number false "See /embed"
+// @Param        qim_step         formData  int    false "See /embed"
+// @Param        archive          formData  string false "Archive format the stego files are returned in: 'zip' (default) or 'tar'"
+// @Param        output_filename  formData  string false "Output archive filename"
+// @Success      200  {file}  binary  "ZIP or tar archive with one stego file per cover, named after the cover and its shard number"
+// @Failure      400  {object}  models.ErrorResponse "Invalid input or insufficient combined capacity"
+// @Failure      500  {object}  models.ErrorResponse "Processing error"
+// @Router       /embed/shards [post]
+func (h *Handlers) EmbedShardsHandler(c *gin.Context) {
+	h.embedCoverSet(c, coverSet{
+		kind:        "shard",
+		capacity:    "the combined capacity of the %d cover files",
+		invalid:     models.ErrInvalidShardCount,
+		invalidCode: "INVALID_SHARD_COUNT",
+		check:       func(covers int) bool { return covers >= 2 && covers <= 0xFFFF },
+		split: func(req *models.EmbedRequest, covers [][]byte) ([][]byte, []models.Distortion, map[string]string, error) {
+			stegoFiles, distortions, err := h.steganographyService.EmbedShards(req, covers, req.SecretFile, nil)
+			return stegoFiles, distortions, map[string]string{"X-Shard-Count": strconv.Itoa(len(stegoFiles))}, err
+		},
+	})
+}
+
+// ExtractShardsHandler reassembles a secret that was split across several stego files
+// @Summary      Reassemble secret file from several audio files
+// @Description  Extracts the shards of a secret split with /embed/shards, uploaded in any order, and reassembles it.
+// @Description  When shards are missing, the error details list the set identifier, the shard count and the sequence numbers found and missing.
+// @Description  The secret is returned like /extract returns it; the signature status is the least trustworthy one of the shards.
+// @Tags         Steganography
+// @Accept       multipart/form-data
+// @Produce      application/octet-stream,application/zip,application/x-tar
+// @Param        stego_audio      formData  file   true  "Stego audio files holding the shards; repeat the field once per file, in any order"
+// @Param        method           formData  string false "See /extract"
+// @Param        stego_key        formData  string false "See /extract"
+// @Param        identity         formData  string false "See /extract"
+// @Param        identity_file    formData  file   false "See /extract"
+// @Param        trusted_signer   formData  string false "See /extract"
+// @Param        signers_file     formData  file   false "See /extract"
+// @Param        kdf_time         formData  int    false "See /extract"
+// @Param        kdf_memory       formData  int    false "See /extract"
+// @Param        kdf_threads      formData  int    false "See /extract"
+// @Param        archive          formData  string false "Archive format for multi-file payloads: 'zip' (default) or 'tar'"
+// @Param        output_filename  formData  string false "Optional output filename override"
+// @Success      200  {file}  binary  "Reassembled secret file, or a ZIP/tar archive of all files for multi-file payloads"
+// @Failure      400  {object}  models.ErrorResponse "Invalid input, wrong stego key or files from different shard sets"
+// @Failure      422  {object}  models.ErrorResponse "Shards are missing or the integrity check failed"
+// @Failure      500  {object}  models.ErrorResponse "Extraction error"
+// @Router       /extract/shards [post]
+func (h *Handlers) ExtractShardsHandler(c *gin.Context) {
+	h.extractCoverSet(c, func(req *models.ExtractRequest, stegoFiles [][]byte) (*models.ExtractResponse, map[string]string, error) {
+		result, report, err := h.steganographyService.ExtractShards(req, stegoFiles)
+		if errors.Is(err, models.ErrIncompleteShardSet) {
+			return nil, nil, &incompleteSetError{
+				code:    "INCOMPLETE_SHARD_SET",
+				message: fmt.Sprintf("Shard set is incomplete: %d of %d shards provided", len(report.Found), report.Count),
+				details: map[string]interface{}{"set_id": report.SetID, "count": report.Count, "found": report.Found, "missing": report.Missing},
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return result, map[string]string{"X-Shard-Set": report.SetID, "X-Shard-Count": strconv.Itoa(report.Count)}, nil
+	})
+}
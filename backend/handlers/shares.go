@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+	"github.com/gin-gonic/gin"
+)
+
+// EmbedSharesHandler shares a secret file across several cover files with a k-of-n threshold
+// @Summary      Share secret file across several audio files (k-of-n)
+// @Description  Splits a secret with Shamir secret sharing over GF(2^8): any threshold (k) of the n stego files recover it, fewer reveal nothing but its size.
+// @Description  Every cover (up to 255) gets one share in a complete container that records a random set identifier, its share index, the threshold and the share count.
+// @Description  Each cover must be able to hold a whole share.
+// @Description  The stego files are returned in a ZIP or tar archive, in upload order.
+// @Description  The embedding options are those of /embed and apply to every share.
+// @Tags         Steganography
+// @Accept       multipart/form-data
+// @Produce      application/zip,application/x-tar
+// @Param        audio            formData  file   true  "Cover audio files (MP3 or 16-bit PCM WAV); repeat the field once per cover, 2 to 255 covers"
+// @Param        threshold        formData  int    true  "Number of stego files needed to recover the secret (2 up to the number of covers)"
+// @Param        secret           formData  file   true  "See /embed"
+// @Param        secret_mtime     formData  int    false "See /embed"
+// @Param        method           formData  string true  "See /embed"
+// @Param        lsb              formData  int    false "See /embed"
+// @Param        stego_key        formData  string false "See /embed"
+// @Param        use_encryption   formData  bool   false "See /embed"
+// @Param        cipher           formData  string false "See /embed"
+// @Param        recipient        formData  string false "See /embed"
+// @Param        recipients_file  formData  file   false "See /embed"
+// @Param        signing_key      formData  string false "See /embed"
+// @Param        signing_key_file formData  file   false "See /embed"
+// @Param        use_random_start formData  bool   false "See /embed"
+// @Param        use_scatter      formData  bool   false "See /embed"
+// @Param        kdf_time         formData  int    false "See /embed"
+// @Param        kdf_memory       formData  int    false "See /embed"
+// @Param        kdf_threads      formData  int    false "See /embed"
+// @Param        public_header    formData  bool   false "See /embed"
+// @Param        ecc              formData  string false "See /embed"
+// @Param        decode_to_pcm    formData  bool   false "See /embed"
+// @Param        chip_rate        formData  int    false "See /embed"
+// @Param        gain             formData  number false "See /embed"
+// @Param        qim_step         formData  int    false "See /embed"
+// @Param        archive          formData  string false "Archive format the stego files are returned in: 'zip' (default) or 'tar'"
+// @Param        output_filename  formData  string false "Output archive filename"
+// @Success      200  {file}  binary  "ZIP or tar archive with one stego file per cover, named after the cover and its share index"
+// @Failure      400  {object}  models.ErrorResponse "Invalid input, invalid threshold or a cover too small for a share"
+// @Failure      500  {object}  models.ErrorResponse "Processing error"
+// @Router       /embed/shares [post]
+func (h *Handlers) EmbedSharesHandler(c *gin.Context) {
+	var threshold int
+	h.embedCoverSet(c, coverSet{
+		kind:        "share",
+		capacity:    "the capacity of the smallest of the %d cover files, which must each hold a whole share,",
+		invalid:     models.ErrInvalidThreshold,
+		invalidCode: "INVALID_THRESHOLD",
+		check: func(covers int) bool {
+			var err error
+			threshold, err = strconv.Atoi(c.PostForm("threshold"))
+			return err == nil && threshold >= 2 && threshold <= covers && covers <= 255
+		},
+		split: func(req *models.EmbedRequest, covers [][]byte) ([][]byte, []models.Distortion, map[string]string, error) {
+			stegoFiles, distortions, err := h.steganographyService.EmbedShares(req, covers, req.SecretFile, nil, threshold)
+			return stegoFiles, distortions, map[string]string{
+				"X-Share-Threshold": strconv.Itoa(threshold),
+				"X-Share-Count":     strconv.Itoa(len(stegoFiles)),
+			}, err
+		},
+	})
+}
+
+// ExtractSharesHandler recovers a secret from at least threshold of its share stego files
+// @Summary      Recover secret file from k of n audio files
+// @Description  Extracts the shares of a secret shared with /embed/shares, uploaded in any order, and recovers it from at least threshold distinct shares.
+// @Description  With too few shares, the error details list the set identifier, the threshold, the share count, the indices found and how many more are needed.
+// @Description  The secret is returned like /extract returns it; the signature status is the least trustworthy one of the shares.
+// @Tags         Steganography
+// @Accept       multipart/form-data
+// @Produce      application/octet-stream,application/zip,application/x-tar
+// @Param        stego_audio      formData  file   true  "Stego audio files holding the shares; repeat the field once per file, in any order"
+// @Param        method           formData  string false "See /extract"
+// @Param        stego_key        formData  string false "See /extract"
+// @Param        identity         formData  string false "See /extract"
+// @Param        identity_file    formData  file   false "See /extract"
+// @Param        trusted_signer   formData  string false "See /extract"
+// @Param        signers_file     formData  file   false "See /extract"
+// @Param        kdf_time         formData  int    false "See /extract"
+// @Param        kdf_memory       formData  int    false "See /extract"
+// @Param        kdf_threads      formData  int    false "See /extract"
+// @Param        archive          formData  string false "Archive format for multi-file payloads: 'zip' (default) or 'tar'"
+// @Param        output_filename  formData  string false "Optional output filename override"
+// @Success      200  {file}  binary  "Recovered secret file, or a ZIP/tar archive of all files for multi-file payloads"
+// @Failure      400  {object}  models.ErrorResponse "Invalid input, wrong stego key or files from different share sets"
+// @Failure      422  {object}  models.ErrorResponse "Too few shares or the integrity check failed"
+// @Failure      500  {object}  models.ErrorResponse "Extraction error"
+// @Router       /extract/shares [post]
+func (h *Handlers) ExtractSharesHandler(c *gin.Context) {
+	h.extractCoverSet(c, func(req *models.ExtractRequest, stegoFiles [][]byte) (*models.ExtractResponse, map[string]string, error) {
+		result, report, err := h.steganographyService.ExtractShares(req, stegoFiles)
+		if errors.Is(err, models.ErrNotEnoughShares) {
+			return nil, nil, &incompleteSetError{
+				code:    "NOT_ENOUGH_SHARES",
+				message: fmt.Sprintf("Not enough shares: %d of the %d needed provided", len(report.Found), report.Threshold),
+				details: map[string]interface{}{"set_id": report.SetID, "threshold": report.Threshold, "count": report.Count, "found": report.Found, "needed": report.Needed},
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return result, map[string]string{
+			"X-Share-Set":       report.SetID,
+			"X-Share-Threshold": strconv.Itoa(report.Threshold),
+			"X-Share-Count":     strconv.Itoa(report.Count),
+		}, nil
+	})
+}
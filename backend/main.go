@@ -58,7 +58,7 @@ func main() {
 	cryptographyService := service.NewCryptographyService()
 	audioService := service.NewAudioService()
 	audioEncoder := service.NewAudioEncoder()
-	steganographyService := service.NewStegoService(cryptographyService, audioService)
+	steganographyService := service.NewStegoService(cryptographyService, audioService, audioEncoder)
 	log.Println("[INFO] All services initialized successfully")
 
 	// Initialize handlers with injected services
@@ -74,8 +74,14 @@ func main() {
 	{
 		v1.GET("/health", h.HealthHandler)
 		v1.POST("/capacity", h.CalculateCapacityHandler)
+		v1.POST("/keys", h.GenerateKeyPairHandler)
 		v1.POST("/embed", h.EmbedHandler)
+		v1.POST("/embed/shards", h.EmbedShardsHandler)
+		v1.POST("/embed/shares", h.EmbedSharesHandler)
+		v1.POST("/embed/deniable", h.EmbedDeniableHandler)
 		v1.POST("/extract", h.ExtractHandler)
+		v1.POST("/extract/shards", h.ExtractShardsHandler)
+		v1.POST("/extract/shares", h.ExtractSharesHandler)
 	}
 
 	// Get port from environment or use default
@@ -165,10 +171,26 @@ func setupMiddleware(r *gin.Engine) {
 		ExposeHeaders: []string{
 			"Content-Disposition",
 			"X-PSNR-Value",
+			"X-SNR-Value",
 			"X-Embedding-Method",
 			"X-Extraction-Method",
 			"X-Secret-Size",
 			"X-Processing-Time",
+			"X-Format-Version",
+			"X-Original-Size",
+			"X-Embedded-At",
+			"X-Archive-Entries",
+			"X-Shard-Set",
+			"X-Shard-Count",
+			"X-Share-Set",
+			"X-Share-Threshold",
+			"X-Share-Count",
+			"X-Public-Key",
+			"X-Signature-Status",
+			"X-Signer",
+			"X-Chip-Rate",
+			"X-Gain",
+			"X-QIM-Step",
 		},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// SecretEntry is one file of a multi-file payload
+type SecretEntry struct {
+	Name    string    `json:"name"`
+	Size    int       `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Data    []byte    `json:"-"`
+}
+
+// ArchiveFormat selects the archive a multi-file payload is returned in
+type ArchiveFormat string
+
+const (
+	ArchiveZIP ArchiveFormat = "zip"
+	ArchiveTar ArchiveFormat = "tar"
+)
+
+// IsValid checks if the archive format is supported
+func (af ArchiveFormat) IsValid() bool {
+	return af == ArchiveZIP || af == ArchiveTar
+}
+
+// MimeType returns the Content-Type used when serving an archive in this format
+func (af ArchiveFormat) MimeType() string {
+	if af == ArchiveTar {
+		return "application/x-tar"
+	}
+	return "application/zip"
+}
+
+// Extension returns the file extension (including the dot) for this format
+func (af ArchiveFormat) Extension() string {
+	if af == ArchiveTar {
+		return ".tar"
+	}
+	return ".zip"
+}
@@ -0,0 +1,40 @@
+package models
+
+// AudioFormat represents the container format of an audio file
+type AudioFormat string
+
+const (
+	FormatUnknown AudioFormat = ""
+	FormatMP3     AudioFormat = "mp3"
+	FormatWAV     AudioFormat = "wav"
+)
+
+// MimeType returns the Content-Type used when serving audio in this format
+func (af AudioFormat) MimeType() string {
+	switch af {
+	case FormatWAV:
+		return "audio/wav"
+	case FormatMP3:
+		return "audio/mpeg"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Extension returns the file extension (including the dot) for this format
+func (af AudioFormat) Extension() string {
+	switch af {
+	case FormatWAV:
+		return ".wav"
+	case FormatMP3:
+		return ".mp3"
+	default:
+		return ".bin"
+	}
+}
+
+// Distortion measures how much embedding changed the samples of a cover, in dB
+type Distortion struct {
+	PSNR float64 // peak signal-to-noise ratio, relative to the 16-bit full scale
+	SNR  float64 // signal-to-noise ratio, relative to the power of the cover
+}
@@ -8,4 +8,24 @@ type CapacityResult struct {
 	FourLSB  int `json:"4_lsb"`
 	// Parity coding capacity (1 bit per byte)
 	Parity int `json:"parity"`
+	// MP3 bitstream capacity (1 bit per granule and channel, 0 for WAV covers)
+	Bitstream int `json:"bitstream"`
+	// LSB matching capacity (1 bit per byte, the slots of 1 LSB)
+	LSBMatching int `json:"lsb_matching"`
+	// Echo hiding capacity (1 bit per 2048 samples of the decoded audio)
+	Echo int `json:"echo"`
+	// Phase coding capacity (1 bit per bin of the 4096-bin band of the first loud 65536-sample segment of the decoded audio)
+	Phase int `json:"phase"`
+	// Direct-sequence spread spectrum capacity (1 bit per dsss_chip_rate samples of the decoded audio)
+	DSSS int `json:"dsss"`
+	// Quantization index modulation capacity (1 bit per sample of the decoded audio)
+	QIM int `json:"qim"`
+	// DCT coefficient capacity (1 bit per mid-frequency coefficient, 128 per 1024-sample frame and channel of the decoded audio)
+	DCT int `json:"dct"`
+	// Chip rate the DSSS capacity is given for
+	ChipRate int `json:"dsss_chip_rate,omitempty"`
+	// Effective capacities left for the secret once Reed–Solomon parity is added, per ECC level
+	ECC map[ECCLevel]*CapacityResult `json:"ecc,omitempty"`
+	// Capacities of each of the two layers of a deniable embedding, which share the carrier
+	Layer *CapacityResult `json:"deniable_layer,omitempty"`
 }
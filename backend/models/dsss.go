@@ -0,0 +1,32 @@
+package models
+
+// DSSSParams holds the spreading parameters of the DSSS method
+type DSSSParams struct {
+	ChipRate int     // samples per channel spreading one bit, a power of two
+	Gain     float64 // amplitude of the chips relative to the RMS of the cover samples they are added to
+}
+
+// DefaultDSSSParams returns 2048 chips per bit at a gain of 0.05 (26 dB below the music)
+func DefaultDSSSParams() DSSSParams {
+	return DSSSParams{ChipRate: 2048, Gain: 0.05}
+}
+
+// IsValid checks that the chip rate is valid and the gain within (0, 1]
+func (p DSSSParams) IsValid() bool {
+	return IsValidChipRate(p.ChipRate) && p.Gain > 0 && p.Gain <= 1
+}
+
+// IsValidChipRate checks that chipRate is a power of two from 256 to 16384: fewer chips no longer
+// lift a bit above the music, and more leave too little capacity for a header.
+func IsValidChipRate(chipRate int) bool {
+	return chipRate >= 256 && chipRate <= 16384 && chipRate&(chipRate-1) == 0
+}
+
+// GetChipRates returns the chip rates accepted by the DSSS method
+func GetChipRates() []int {
+	var rates []int
+	for rate := 256; rate <= 16384; rate *= 2 {
+		rates = append(rates, rate)
+	}
+	return rates
+}
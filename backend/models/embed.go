@@ -1,16 +1,30 @@
 package models
 
+import "strings"
+
 // SteganographyMethod represents the type of steganography method to use
 type SteganographyMethod string
 
 const (
-	MethodLSB    SteganographyMethod = "lsb"
-	MethodParity SteganographyMethod = "parity"
+	MethodLSB         SteganographyMethod = "lsb"
+	MethodParity      SteganographyMethod = "parity"
+	MethodBitstream   SteganographyMethod = "bitstream"
+	MethodLSBMatching SteganographyMethod = "lsb_matching"
+	MethodEcho        SteganographyMethod = "echo"
+	MethodPhase       SteganographyMethod = "phase"
+	MethodDSSS        SteganographyMethod = "dsss"
+	MethodQIM         SteganographyMethod = "qim"
+	MethodDCT         SteganographyMethod = "dct"
 )
 
 // IsValid checks if the steganography method is valid
 func (sm SteganographyMethod) IsValid() bool {
-	return sm == MethodLSB || sm == MethodParity
+	for _, m := range GetSupportedMethods() {
+		if sm == m {
+			return true
+		}
+	}
+	return false
 }
 
 // String returns the string representation of the method
@@ -18,23 +32,156 @@ func (sm SteganographyMethod) String() string {
 	return string(sm)
 }
 
+// Description returns a short human readable description of the method
+func (sm SteganographyMethod) Description() string {
+	switch sm {
+	case MethodLSB:
+		return "Least Significant Bit method (supports 1-4 LSBs)"
+	case MethodParity:
+		return "Parity bit method (1 bit per byte, more robust)"
+	case MethodBitstream:
+		return "MP3 bitstream method (global_gain LSB per granule, stream stays decodable)"
+	case MethodLSBMatching:
+		return "LSB matching method (1 bit per carrier, random ±1 instead of LSB replacement, resists histogram attacks)"
+	case MethodEcho:
+		return "Echo hiding method (1 bit per 2048 samples as a pair of faint echoes, needs ECC 'medium' or 'high')"
+	case MethodPhase:
+		return "Phase coding method (1 bit per frequency bin of a mid band in the phase of the first loud 65536-sample segment)"
+	case MethodDSSS:
+		return "Direct-sequence spread spectrum method (1 bit per chip_rate samples as keyed pseudo-noise, read back after added noise or a start delay of up to 4096 samples)"
+	case MethodQIM:
+		return "Quantization index modulation method (1 bit per sample quantized onto one of two key-dithered lattices, robustness set by the step)"
+	case MethodDCT:
+		return "DCT method (1 bit per mid-frequency DCT coefficient, 128 per 1024-sample frame, quantized to an even or odd multiple of a fixed step)"
+	default:
+		return ""
+	}
+}
+
 // GetSupportedMethods returns a list of supported steganography methods
 func GetSupportedMethods() []SteganographyMethod {
-	return []SteganographyMethod{MethodLSB, MethodParity}
+	return []SteganographyMethod{MethodLSB, MethodParity, MethodBitstream, MethodLSBMatching, MethodEcho, MethodPhase, MethodDSSS, MethodQIM, MethodDCT}
+}
+
+// MethodList returns the supported methods quoted for messages: 'lsb', 'parity', ... or 'dct'
+func MethodList() string {
+	methods := GetSupportedMethods()
+	quoted := make([]string, len(methods))
+	for i, m := range methods {
+		quoted[i] = "'" + string(m) + "'"
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
+
+// IsSignalDomain reports whether the method shapes the decoded audio signal instead of storing bits
+// in sample or frame bytes. MP3 covers are then always decoded to PCM and the stego file is WAV.
+func (sm SteganographyMethod) IsSignalDomain() bool {
+	return sm == MethodEcho || sm == MethodPhase || sm == MethodDSSS || sm == MethodQIM || sm == MethodDCT
+}
+
+// IsKeyed reports whether the carrier itself is keyed with the stego key, so that it only reads back
+// under the key used for embedding
+func (sm SteganographyMethod) IsKeyed() bool {
+	return sm == MethodDSSS || sm == MethodQIM
+}
+
+// DefaultECC returns the ECC level used when none is requested. Signal-domain methods read some
+// bits back wrong even from an untouched stego file or are meant to survive processing of it, so
+// they are protected by default.
+func (sm SteganographyMethod) DefaultECC() ECCLevel {
+	if sm.IsSignalDomain() {
+		return ECCHigh
+	}
+	return ECCNone
+}
+
+// MinECC returns the least ECC level the method can be embedded with. Echo hiding caps the echo
+// strength, so a few segments read back wrong even from an untouched stego file.
+func (sm SteganographyMethod) MinECC() ECCLevel {
+	if sm == MethodEcho {
+		return ECCMedium
+	}
+	return ECCNone
+}
+
+// CipherType represents the cipher used to encrypt the secret before embedding
+type CipherType string
+
+const (
+	CipherVigenere CipherType = "vigenere"
+	CipherAESGCM   CipherType = "aes-gcm"
+)
+
+// IsValid checks if the cipher type is supported
+func (ct CipherType) IsValid() bool {
+	return ct == CipherVigenere || ct == CipherAESGCM
+}
+
+// ECCLevel selects how much Reed–Solomon redundancy protects the embedded container
+type ECCLevel string
+
+const (
+	ECCNone   ECCLevel = "none"
+	ECCLow    ECCLevel = "low"
+	ECCMedium ECCLevel = "medium"
+	ECCHigh   ECCLevel = "high"
+)
+
+// IsValid checks if the ECC level is supported; the empty level means no ECC
+func (l ECCLevel) IsValid() bool {
+	return l == "" || l == ECCNone || l == ECCLow || l == ECCMedium || l == ECCHigh
+}
+
+// ParityBytes returns the Reed–Solomon parity bytes added to every 255-byte block.
+// A block corrects up to half as many corrupted bytes.
+func (l ECCLevel) ParityBytes() int {
+	switch l {
+	case ECCLow:
+		return 16
+	case ECCMedium:
+		return 32
+	case ECCHigh:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// Covers reports whether the level adds at least the redundancy of least
+func (l ECCLevel) Covers(least ECCLevel) bool {
+	return l.ParityBytes() >= least.ParityBytes()
+}
+
+// GetECCLevels returns the ECC levels that add redundancy
+func GetECCLevels() []ECCLevel {
+	return []ECCLevel{ECCLow, ECCMedium, ECCHigh}
 }
 
 type EmbedRequest struct {
 	CoverAudio     []byte
 	SecretFile     []byte
 	SecretFileName string
+	SecretMimeType string        // Optional MIME type of the secret, recorded in the container header
+	SecretEntries  []SecretEntry // Several secret files embedded as one payload; replaces the secret passed to EmbedMessage
 	StegoKey       string
-	Method         SteganographyMethod // "lsb" or "parity"
+	Method         SteganographyMethod // One of GetSupportedMethods
 	NLsb           int                 // Only used for LSB method (1-4)
 	UseEncryption  bool
+	Cipher         CipherType // Only used when UseEncryption is set, defaults to Vigenère
 	UseRandomStart bool
+	UseScatter     bool        // Spread the payload bits over the whole cover with a key-driven permutation
+	KDF            *KDFParams  // Argon2id cost for deriving keys from StegoKey, nil uses DefaultKDFParams
+	PublicHeader   bool        // Store the KDF cost and container header in clear instead of hiding them with the key
+	ECC            ECCLevel    // Reed–Solomon redundancy added to header and payload, empty means none
+	DecodeToPCM    bool        // Decode MP3 covers to PCM and embed into samples (output is WAV)
+	Recipients     [][]byte    // X25519 public keys the secret is encrypted to (AES-256-GCM under a wrapped file key)
+	SigningKey     []byte      // Ed25519 private key seed the container is signed with, nil for no signature
+	DSSS           *DSSSParams // Only used for DSSS method, nil uses DefaultDSSSParams
+	QIMStep        int         // Only used for QIM method: quantization step in sample units, 0 uses DefaultQIMStep
 }
 
 type EmbedResponse struct {
 	StegoAudio []byte
 	PSNR       float64
+	SNR        float64
 }
@@ -7,14 +7,38 @@ import (
 // Predefined errors for steganography operations
 var (
 	ErrInvalidMP3           = errors.New("failed to decode audio data, not a valid MP3 file")
+	ErrInvalidWAV           = errors.New("unsupported WAV file, only 16-bit PCM WAV is supported")
 	ErrInsufficientCapacity = errors.New("insufficient audio capacity for the provided data")
 	ErrInvalidLSB           = errors.New("LSB value must be between 1 and 4")
-	ErrInvalidMethod        = errors.New("invalid steganography method, must be 'lsb' or 'parity'")
-	ErrInvalidStegoKey      = errors.New("steganography key cannot be empty when encryption or random start is enabled")
+	ErrInvalidMethod        = errors.New("invalid steganography method, must be " + MethodList())
+	ErrUnsupportedFormat    = errors.New("steganography method is not supported for this audio format")
+	ErrInvalidCipher        = errors.New("invalid cipher, must be 'vigenere' or 'aes-gcm'")
+	ErrInvalidECCLevel      = errors.New("invalid ECC level, must be 'none', 'low', 'medium' or 'high'")
+	ErrECCTooLow            = errors.New("ECC level too low for the method, echo needs 'medium' or 'high'")
+	ErrInvalidDSSSParams    = errors.New("invalid DSSS parameters: chip rate must be a power of two from 256 to 16384, gain above 0 and at most 1")
+	ErrInvalidQIMStep       = errors.New("invalid QIM step: must be a power of two from 2 to 1024")
+	ErrInvalidKDFParams     = errors.New("invalid key derivation parameters: time must be 1-4, memory 8-256 MiB, threads 1-16")
+	ErrInvalidStegoKey      = errors.New("invalid steganography key - it is missing or does not match the key used for embedding")
 	ErrInvalidSignature     = errors.New("invalid steganography signature - data may not be embedded or corrupted")
 	ErrFileTooLarge         = errors.New("file size exceeds maximum allowed limit")
 	ErrInvalidFileFormat    = errors.New("invalid file format")
 	ErrCorruptedData        = errors.New("embedded data appears to be corrupted")
+	ErrIntegrityFailed      = errors.New("integrity check failed - embedded data has been modified or damaged")
+	ErrInvalidShardCount    = errors.New("a shard set needs between 2 and 65535 cover files")
+	ErrShardedSecret        = errors.New("stego file holds one shard of a split secret, extract it together with the other shards")
+	ErrShardSetMismatch     = errors.New("stego files do not belong to the same shard set")
+	ErrIncompleteShardSet   = errors.New("shard set is incomplete")
+	ErrInvalidThreshold     = errors.New("threshold must be at least 2 and at most the number of cover files, which is limited to 255")
+	ErrSecretShare          = errors.New("stego file holds one share of a threshold-shared secret, extract it together with the other shares")
+	ErrShareSetMismatch     = errors.New("stego files do not belong to the same share set")
+	ErrNotEnoughShares      = errors.New("not enough shares to recover the secret")
+	ErrInvalidRecipient     = errors.New("invalid recipient public key")
+	ErrInvalidIdentity      = errors.New("invalid recipient private key")
+	ErrNoMatchingIdentity   = errors.New("secret is encrypted to recipient public keys - none of the provided private keys matches")
+	ErrInvalidSigningKey    = errors.New("invalid signing key, exactly one 'ASTEGO-SIGNING-KEY-...' key is expected")
+	ErrInvalidSigner        = errors.New("invalid trusted signer public key")
+	ErrDeniableKeys         = errors.New("deniable embedding needs a different stego key for every layer and a hidden header")
+	ErrDeniableMethod       = errors.New("deniable embedding does not support the dsss and qim methods, whose carrier is keyed with the stego key of one layer")
 	ErrExtractionFailed     = errors.New("failed to extract data - wrong key or parameters")
 )
 
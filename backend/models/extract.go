@@ -1,15 +1,31 @@
 package models
 
+import "time"
+
 type ExtractRequest struct {
 	StegoAudio     []byte              `json:"stego_audio"`
 	StegoKey       string              `json:"stego_key,omitempty"`
 	Method         SteganographyMethod `json:"method,omitempty"` // Optional: auto-detect if not provided
+	KDF            *KDFParams          `json:"kdf,omitempty"`    // Argon2id cost used at embedding for hidden headers, nil uses DefaultKDFParams
+	Identities     [][]byte            `json:"-"`                // X25519 private keys tried on secrets encrypted to recipients
+	TrustedSigners [][]byte            `json:"-"`                // Ed25519 public keys whose signatures are reported as verified
 	OutputFilename string              `json:"output_filename,omitempty"`
 }
 
 type ExtractResponse struct {
-	SecretData   []byte `json:"secret_data"`
-	Filename     string `json:"filename"`
-	FileSize     int    `json:"file_size"`
-	ExtractionOK bool   `json:"extraction_ok"`
+	SecretData    []byte     `json:"secret_data"`
+	Filename      string     `json:"filename"`
+	FileSize      int        `json:"file_size"`
+	ExtractionOK  bool       `json:"extraction_ok"`
+	MimeType      string     `json:"mime_type,omitempty"`     // MIME type recorded at embedding, if any
+	OriginalSize  int64      `json:"original_size,omitempty"` // Size of the secret before compression and encryption
+	EmbeddedAt    *time.Time `json:"embedded_at,omitempty"`
+	FormatVersion int        `json:"format_version"`      // Container version the secret was read from (2 or 3)
+	ChipRate      int        `json:"chip_rate,omitempty"` // Chip rate the secret was spread with, for the DSSS method
+	Gain          float64    `json:"gain,omitempty"`      // Gain of the chips relative to the music, for the DSSS method
+	QIMStep       int        `json:"qim_step,omitempty"`  // Quantization step the secret was embedded with, for the QIM method
+	// Files of a multi-file payload; SecretData then holds their contents back to back
+	Entries []SecretEntry `json:"entries,omitempty"`
+	// Sender signature and whether it verified against the trusted signers
+	Signature SignatureInfo `json:"signature"`
 }
@@ -0,0 +1,22 @@
+package models
+
+// KDFParams holds the Argon2id cost parameters used to derive keys from a stego key
+type KDFParams struct {
+	Time      uint8  // number of passes over memory
+	MemoryMiB uint16 // memory cost in MiB
+	Threads   uint8  // degree of parallelism
+}
+
+// DefaultKDFParams returns the second recommended Argon2id setting of RFC 9106 (t=3, 64 MiB, p=4)
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Time: 3, MemoryMiB: 64, Threads: 4}
+}
+
+// IsValid checks that the cost parameters are within the range accepted by the service.
+// A public key preamble stores the cost unauthenticated and every extraction runs Argon2id with
+// it, so the upper bounds keep a crafted stego file at a few times the default cost.
+func (p KDFParams) IsValid() bool {
+	return p.Time >= 1 && p.Time <= 4 &&
+		p.MemoryMiB >= 8 && p.MemoryMiB <= 256 &&
+		p.Threads >= 1 && p.Threads <= 16
+}
@@ -0,0 +1,20 @@
+package models
+
+// DefaultQIMStep is the quantization step of the QIM method when none is requested: samples move by
+// at most 32, about 65 dB below full scale, and read back unless they change by 16 or more
+const DefaultQIMStep = 64
+
+// IsValidQIMStep checks that step is a power of two from 2 to 1024: a step of 1 would leave 16-bit
+// samples unchanged, and at 1024 the samples already move by up to 512.
+func IsValidQIMStep(step int) bool {
+	return step >= 2 && step <= 1024 && step&(step-1) == 0
+}
+
+// GetQIMSteps returns the quantization steps accepted by the QIM method
+func GetQIMSteps() []int {
+	var steps []int
+	for step := 2; step <= 1024; step *= 2 {
+		steps = append(steps, step)
+	}
+	return steps
+}
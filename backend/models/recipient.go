@@ -0,0 +1,33 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// KeyType selects the kind of key pair generated
+type KeyType string
+
+const (
+	KeyTypeRecipient KeyType = "recipient" // X25519, secrets are encrypted to the public key
+	KeyTypeSigning   KeyType = "signing"   // Ed25519, containers are signed with the private key
+)
+
+// IsValid checks if the key type is supported; the empty type means a recipient key pair
+func (kt KeyType) IsValid() bool {
+	return kt == "" || kt == KeyTypeRecipient || kt == KeyTypeSigning
+}
+
+// KeyPair is a key pair in its text encoding: an X25519 recipient key pair, where secrets embedded
+// for the public key can only be extracted with the private key, or an Ed25519 signing key pair,
+// where the public key verifies containers signed with the private key.
+type KeyPair struct {
+	PublicKey  string    `json:"public_key"`
+	PrivateKey string    `json:"private_key"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IdentityFile returns the key file holding the private key, with the public key as a comment
+func (kp KeyPair) IdentityFile() []byte {
+	return fmt.Appendf(nil, "# created: %s\n# public key: %s\n%s\n", kp.CreatedAt.Format(time.RFC3339), kp.PublicKey, kp.PrivateKey)
+}
@@ -0,0 +1,18 @@
+package models
+
+// ShardSetReport describes the shards of a split secret found among the uploaded stego files
+type ShardSetReport struct {
+	SetID   string `json:"set_id"`  // hex encoded set identifier shared by all shards
+	Count   int    `json:"count"`   // number of shards the secret was split into
+	Found   []int  `json:"found"`   // sequence numbers (1-based) of the shards present
+	Missing []int  `json:"missing"` // sequence numbers of the shards still needed
+}
+
+// ShareSetReport describes the shares of a threshold-shared secret found among the uploaded stego files
+type ShareSetReport struct {
+	SetID     string `json:"set_id"`    // hex encoded set identifier shared by all shares
+	Threshold int    `json:"threshold"` // number of shares needed to recover the secret
+	Count     int    `json:"count"`     // number of shares that were created
+	Found     []int  `json:"found"`     // indices (1-based) of the distinct shares present
+	Needed    int    `json:"needed"`    // further shares still needed, 0 once the threshold is reached
+}
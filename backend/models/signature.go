@@ -0,0 +1,40 @@
+package models
+
+// SignatureStatus tells whether an extracted secret was signed and whether the signer is trusted
+type SignatureStatus string
+
+const (
+	SignatureUnsigned  SignatureStatus = "unsigned"  // no signature was embedded
+	SignatureInvalid   SignatureStatus = "invalid"   // the signature does not match the embedded data
+	SignatureUntrusted SignatureStatus = "untrusted" // valid, but the signer is not among the trusted keys
+	SignatureVerified  SignatureStatus = "verified"  // valid and made by one of the trusted keys
+)
+
+// rank orders the statuses from least to most trustworthy
+func (s SignatureStatus) rank() int {
+	switch s {
+	case SignatureInvalid:
+		return 0
+	case SignatureUntrusted:
+		return 2
+	case SignatureVerified:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// SignatureInfo reports the sender signature of an extracted secret
+type SignatureInfo struct {
+	Status SignatureStatus `json:"status"`
+	Signer string          `json:"signer,omitempty"` // signer public key ('astego-signer-...') recorded in the container
+}
+
+// Weakest returns the less trustworthy of two signature reports, used for secrets read from
+// several stego files
+func (si SignatureInfo) Weakest(other SignatureInfo) SignatureInfo {
+	if other.Status.rank() < si.Status.rank() {
+		return other
+	}
+	return si
+}
@@ -3,8 +3,13 @@ package service
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"io"
 	"log"
 	"math"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+	"github.com/hajimehoshi/go-mp3"
 )
 
 // audioService implements the AudioService interface
@@ -64,13 +69,105 @@ func (a *audioService) CalculatePSNR(original, modified []byte) float64 {
 	return psnr
 }
 
-// EncodeToWAV encodes PCM data to WAV format
-func (e *audioEncoder) EncodeToWAV(pcmData []byte, sampleRate int) ([]byte, error) {
+// CalculateSNR calculates Signal-to-Noise Ratio between original and modified audio:
+// SNR = 10 * log10(Σ original² / Σ (original - modified)²), the power of the cover over the power of
+// the changes embedding made. Unlike PSNR it does not rise for quiet covers.
+func (a *audioService) CalculateSNR(original, modified []byte) float64 {
+	if len(original) != len(modified) {
+		log.Printf("[WARN] CalculateSNR: Length mismatch - original: %d, modified: %d", len(original), len(modified))
+		return 0.0
+	}
+
+	var signal, noise float64
+	for i := 0; i < len(original)-1; i += 2 {
+		originalSample := float64(int16(binary.LittleEndian.Uint16(original[i : i+2])))
+		modifiedSample := float64(int16(binary.LittleEndian.Uint16(modified[i : i+2])))
+
+		diff := originalSample - modifiedSample
+		signal += originalSample * originalSample
+		noise += diff * diff
+	}
+
+	// Avoid division by zero
+	if noise == 0 {
+		return math.Inf(1) // Perfect match
+	}
+	if signal == 0 {
+		return 0.0 // Silent cover
+	}
+
+	snr := 10 * math.Log10(signal/noise)
+
+	log.Printf("[DEBUG] CalculateSNR: signal=%.2f, noise=%.2f, SNR=%.2f dB", signal, noise, snr)
+	return snr
+}
+
+// DetectFormat detects the container format of the audio data from its signature.
+// WAV files are recognised by the RIFF/WAVE header, MP3 files by an ID3v2 tag or a valid frame header.
+func (a *audioService) DetectFormat(audioData []byte) models.AudioFormat {
+	if isWAVData(audioData) {
+		return models.FormatWAV
+	}
+
+	start := parseID3v2Size(audioData)
+	if start > 0 && start < len(audioData) {
+		return models.FormatMP3
+	}
+	if findFirstFrame(audioData) >= 0 {
+		return models.FormatMP3
+	}
+
+	log.Printf("[WARN] DetectFormat: Unable to detect audio format (%d bytes)", len(audioData))
+	return models.FormatUnknown
+}
+
+// DecodeMP3 decodes MP3 data to interleaved 16-bit little-endian PCM.
+// The decoder always produces stereo output, so mono streams are reduced back to one channel.
+func (a *audioService) DecodeMP3(mp3Data []byte) ([]byte, int, int, error) {
+	firstFrame := findFirstFrame(mp3Data)
+	if firstFrame < 0 {
+		return nil, 0, 0, models.ErrInvalidMP3
+	}
+
+	decoder, err := mp3.NewDecoder(bytes.NewReader(mp3Data))
+	if err != nil {
+		log.Printf("[ERROR] DecodeMP3: Failed to create decoder: %v", err)
+		return nil, 0, 0, models.ErrInvalidMP3
+	}
+	pcmData, err := io.ReadAll(decoder)
+	if err != nil {
+		log.Printf("[ERROR] DecodeMP3: Failed to decode stream: %v", err)
+		return nil, 0, 0, models.ErrInvalidMP3
+	}
+
+	// Channel mode 0b11 in the 4th header byte means single channel
+	channels := 2
+	if (mp3Data[firstFrame+3]>>6)&0x03 == 0x03 {
+		channels = 1
+		mono := make([]byte, 0, len(pcmData)/2)
+		for i := 0; i+3 < len(pcmData); i += 4 {
+			mono = append(mono, pcmData[i], pcmData[i+1]) // keep left channel only
+		}
+		pcmData = mono
+	}
+
+	log.Printf("[DEBUG] DecodeMP3: Decoded %d bytes of PCM (sample rate: %d, channels: %d)",
+		len(pcmData), decoder.SampleRate(), channels)
+	return pcmData, decoder.SampleRate(), channels, nil
+}
+
+// EncodeToWAV encodes interleaved 16-bit PCM data to WAV format
+func (e *audioEncoder) EncodeToWAV(pcmData []byte, sampleRate int, channels int) ([]byte, error) {
+	if channels < 1 || sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid PCM layout: %d channels at %d Hz", channels, sampleRate)
+	}
+
 	var wav bytes.Buffer
 
 	// WAV header structure
 	dataSize := len(pcmData)
 	fileSize := 36 + dataSize
+	blockAlign := channels * 2 // 16-bit samples
 
 	// RIFF header
 	wav.Write([]byte("RIFF"))
@@ -81,11 +178,11 @@ func (e *audioEncoder) EncodeToWAV(pcmData []byte, sampleRate int) ([]byte, erro
 	wav.Write([]byte("fmt "))
 	binary.Write(&wav, binary.LittleEndian, uint32(16)) // fmt chunk size
 	binary.Write(&wav, binary.LittleEndian, uint16(1))  // PCM format
-	binary.Write(&wav, binary.LittleEndian, uint16(2))  // stereo channels
+	binary.Write(&wav, binary.LittleEndian, uint16(channels))
 	binary.Write(&wav, binary.LittleEndian, uint32(sampleRate))
-	binary.Write(&wav, binary.LittleEndian, uint32(sampleRate*2*2)) // byte rate
-	binary.Write(&wav, binary.LittleEndian, uint16(4))              // block align
-	binary.Write(&wav, binary.LittleEndian, uint16(16))             // bits per sample
+	binary.Write(&wav, binary.LittleEndian, uint32(sampleRate*blockAlign)) // byte rate
+	binary.Write(&wav, binary.LittleEndian, uint16(blockAlign))            // block align
+	binary.Write(&wav, binary.LittleEndian, uint16(16))                    // bits per sample
 
 	// data chunk
 	wav.Write([]byte("data"))
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/binary"
+	"math"
+	mathrand "math/rand"
+)
+
+// bitCarrier exposes the embeddable bit slots of a cover in a fixed, deterministic order.
+// Every steganography method maps payload bits onto slots through this interface, so header
+// handling, random start and capacity checks are shared between methods.
+type bitCarrier interface {
+	// capacity returns the number of bit slots available in the cover
+	capacity() int
+	// bit reads the bit currently stored in slot
+	bit(slot int) uint8
+	// setBit stores bit in slot, modifying the underlying cover
+	setBit(slot int, bit uint8)
+}
+
+// bufferedCarrier is a carrier that collects the bits it is given and writes them into the cover
+// in one pass, for methods where a bit changes more than its own samples
+type bufferedCarrier interface {
+	bitCarrier
+	// flush writes the pending bits into the cover
+	flush()
+}
+
+// flushCarrier writes the pending bits of a buffered carrier into the cover
+func flushCarrier(c bitCarrier) {
+	if b, ok := c.(bufferedCarrier); ok {
+		b.flush()
+	}
+}
+
+// lsbCarrier stores nLsb bits in the least significant bits of every carrier byte
+type lsbCarrier struct {
+	data    []byte
+	indices []int
+	nLsb    int
+}
+
+func (c *lsbCarrier) capacity() int {
+	return len(c.indices) * c.nLsb
+}
+
+func (c *lsbCarrier) bit(slot int) uint8 {
+	return (c.data[c.indices[slot/c.nLsb]] >> uint(slot%c.nLsb)) & 1
+}
+
+func (c *lsbCarrier) setBit(slot int, bit uint8) {
+	pos := c.indices[slot/c.nLsb] // which payload byte in the cover
+	mask := byte(1) << uint(slot%c.nLsb)
+	if bit == 1 {
+		c.data[pos] |= mask
+	} else {
+		c.data[pos] &^= mask
+	}
+}
+
+// parityCarrier stores one bit per carrier byte as the parity of that byte
+type parityCarrier struct {
+	data    []byte
+	indices []int
+}
+
+func (c *parityCarrier) capacity() int {
+	return len(c.indices)
+}
+
+func (c *parityCarrier) bit(slot int) uint8 {
+	return extractParityBit(c.data[c.indices[slot]])
+}
+
+func (c *parityCarrier) setBit(slot int, bit uint8) {
+	pos := c.indices[slot]
+	c.data[pos] = embedParityBit(c.data[pos], bit)
+}
+
+// bitPositionCarrier stores one bit at each absolute bit position of the cover.
+// Positions are counted MSB-first (position p is bit 7-p%8 of byte p/8), matching MP3 bitstream order.
+type bitPositionCarrier struct {
+	data      []byte
+	positions []int
+}
+
+func (c *bitPositionCarrier) capacity() int {
+	return len(c.positions)
+}
+
+func (c *bitPositionCarrier) bit(slot int) uint8 {
+	p := c.positions[slot]
+	return (c.data[p/8] >> uint(7-p%8)) & 1
+}
+
+func (c *bitPositionCarrier) setBit(slot int, bit uint8) {
+	p := c.positions[slot]
+	mask := byte(1) << uint(7-p%8)
+	if bit == 1 {
+		c.data[p/8] |= mask
+	} else {
+		c.data[p/8] &^= mask
+	}
+}
+
+// matchingCarrier stores one bit per carrier byte in its least significant bit, like 1-bit LSB, but
+// fixes a mismatching bit by adding or subtracting 1 at random instead of overwriting it. Replacement
+// only moves values within the pairs 2k/2k+1, which chi-square and RS analysis detect; matching keeps
+// the histogram smooth. For 16-bit PCM the whole sample is changed, carrying into its high byte.
+type matchingCarrier struct {
+	data    []byte
+	indices []int
+	samples bool // indices point at the low byte of little-endian 16-bit samples
+	rng     *mathrand.Rand
+}
+
+func (c *matchingCarrier) capacity() int {
+	return len(c.indices)
+}
+
+func (c *matchingCarrier) bit(slot int) uint8 {
+	return c.data[c.indices[slot]] & 1
+}
+
+func (c *matchingCarrier) setBit(slot int, bit uint8) {
+	pos := c.indices[slot]
+	if c.data[pos]&1 == bit {
+		return
+	}
+	step := 1
+	if c.rng.Intn(2) == 0 {
+		step = -1
+	}
+	if c.samples {
+		// step away from the clipping limits
+		v := int(int16(binary.LittleEndian.Uint16(c.data[pos:])))
+		if v+step > math.MaxInt16 || v+step < math.MinInt16 {
+			step = -step
+		}
+		binary.LittleEndian.PutUint16(c.data[pos:], uint16(int16(v+step)))
+		return
+	}
+	v := int(c.data[pos])
+	if v+step > 0xFF || v+step < 0 {
+		step = -step
+	}
+	c.data[pos] = byte(v + step)
+}
+
+// bitReader reads the bit stored in a carrier slot
+type bitReader interface {
+	bit(slot int) uint8
+}
+
+// lazyPageSize is the number of slots lazyBits allocates at a time
+const lazyPageSize = 4096
+
+// lazyBits reads the slots of a carrier on demand and remembers them. Extraction reads through it,
+// so a carrier is only decoded as far as the locations tried need: the header of every location
+// and the body of one whose header validates.
+type lazyBits struct {
+	carrier bitCarrier
+	pages   [][]int8 // bits of lazyPageSize slots each, -1 until read; nil while none was read
+}
+
+func newLazyBits(c bitCarrier) *lazyBits {
+	return &lazyBits{carrier: c, pages: make([][]int8, (c.capacity()+lazyPageSize-1)/lazyPageSize)}
+}
+
+func (b *lazyBits) bit(slot int) uint8 {
+	page := b.pages[slot/lazyPageSize]
+	if page == nil {
+		page = make([]int8, lazyPageSize)
+		for i := range page {
+			page[i] = -1
+		}
+		b.pages[slot/lazyPageSize] = page
+	}
+	if page[slot%lazyPageSize] < 0 {
+		page[slot%lazyPageSize] = int8(b.carrier.bit(slot))
+	}
+	return uint8(page[slot%lazyPageSize])
+}
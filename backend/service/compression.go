@@ -0,0 +1,51 @@
+package service
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// Compression codec ids stored in the compression TLV of the container header
+const (
+	compressionNone    = 0
+	compressionDeflate = 1 // raw DEFLATE (RFC 1951) at best compression
+)
+
+// compressSecret compresses the secret with DEFLATE and returns the result with its codec id.
+// Secrets that do not shrink (images, archives, already encrypted data) are returned unchanged.
+func compressSecret(data []byte) ([]byte, int) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return data, compressionNone
+	}
+	if _, err := w.Write(data); err != nil {
+		return data, compressionNone
+	}
+	if err := w.Close(); err != nil || buf.Len() >= len(data) {
+		return data, compressionNone
+	}
+	return buf.Bytes(), compressionDeflate
+}
+
+// decompressSecret reverses compressSecret. originalSize comes from the header and bounds the
+// output, so a forged header cannot make extraction inflate an arbitrarily large stream.
+func decompressSecret(compressionID int, data []byte, originalSize int64) ([]byte, error) {
+	switch compressionID {
+	case compressionNone:
+		return data, nil
+	case compressionDeflate:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, originalSize+1))
+		if err != nil || int64(len(out)) != originalSize {
+			return nil, models.ErrCorruptedData
+		}
+		return out, nil
+	default:
+		return nil, models.ErrCorruptedData
+	}
+}
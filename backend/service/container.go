@@ -0,0 +1,383 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"math"
+	"time"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+/*
+ Container format v3 (binary, fixed order):
+ - 6 bytes magic: "ASTEG\000"
+ - 1 byte version: 3
+ - 1 byte method: 0=LSB, 1=Parity, 2=Bitstream, 3=LSB matching, 4=Echo, 5=Phase, 6=DSSS, 7=QIM, 8=DCT
+ - 1 byte nLSB (1..4, only used for LSB method; log2 of the chip rate for DSSS and of the step for QIM)
+ - 1 byte flags: bit0 = UseEncryption, bit1 = UseRandomStart, bit4 = keys derived with the KDF,
+                 bit5 = Scatter, bit6 = hidden header (container whitened with the header subkey,
+                 see layout.go), bit7 = ECC; bits 2-3 held the cipher id in v2 and are reserved
+ - 2 bytes filename length (uint16 big endian)
+ - 4 bytes payload length (uint32 big endian)  <-- length AFTER encryption (i.e. stored)
+ - 2 bytes TLV block length (uint16 big endian)
+ - filename bytes (utf-8) [filename length]
+ - TLV block: repeated [type(1)][length(2, big endian)][value], unknown types are skipped
+   a multi-file payload has a directory TLV with one record per file:
+   [name length(2)][name][size(4)][modification time(8, unix seconds)], all big endian,
+   and the payload holds the file contents back to back in directory order
+   a shard of a split secret has a shard TLV: [set id(16)][sequence number(2)][shard count(2)];
+   its payload is one part of the compressed secret, the other TLVs describe the whole secret
+   a share of a threshold-shared secret has a share TLV:
+   [set id(16)][share index(1)][threshold(1)][share count(1)]; its payload is one Shamir share of
+   a complete unkeyed container (header, compressed secret and SHA-256 tag), so the metadata of
+   the secret is shared as well and the share container itself holds no other TLVs
+   a secret encrypted to X25519 recipients has a recipients TLV: [count(1)] followed by one
+   stanza per recipient [ephemeral public key(32)][file key sealed with AES-256-GCM(32)], see
+   cryptography_service.go; the payload is then AES-256-GCM encrypted under the file key
+   a signed container has a signer TLV holding the 32-byte Ed25519 public key of the sender
+   a DSSS container has a gain TLV holding the chip gain as a float64 (IEEE 754, big endian)
+ - 4 bytes CRC32 (IEEE) of every header byte above
+ - payload bytes ...
+ - 64 bytes Ed25519 signature over header and payload, only when the header has a signer TLV
+ - 32 bytes integrity tag over header, payload and signature: HMAC-SHA256 under the integrity
+   subkey when a stego key was used, plain SHA-256 otherwise
+
+ The CRC only tells a damaged header from noise; tampering is detected by the tag, and a wrong key
+ by the key check TLV before the tag is verified.
+
+ With ECC the whole container (header and payload) is split into Reed–Solomon blocks of 255 bytes,
+ each carrying 255-n data bytes and n parity bytes (see reed_solomon.go); the ECC TLV holds n as a
+ single byte. A key preamble is then protected with preambleParity parity bytes as well.
+
+ Version 2 files ("ASTEGv2\000" magic, see steganography_service.go) are still read.
+*/
+
+var magicV3 = []byte("ASTEG\x00")
+
+const (
+	containerVersion   = 3
+	containerFixedSize = 6 + 1 + 1 + 1 + 1 + 2 + 4 + 2
+	integrityTagSize   = sha256.Size
+	keyCheckSize       = 4
+)
+
+// TLV field types of the v3 header
+const (
+	tlvOriginalSize  = 0x01 // uint64 size of the secret before compression and encryption
+	tlvMimeType      = 0x02 // MIME type of the secret file (utf-8)
+	tlvCreatedAt     = 0x03 // int64 unix time (seconds) of the embedding
+	tlvCipherID      = 0x04 // 1 byte cipher id, present only when the payload is encrypted
+	tlvCompressionID = 0x05 // 1 byte compression codec id
+	tlvECCParams     = 0x06 // error correction parameters: 1 byte Reed–Solomon parity bytes per block
+	tlvUserMetadata  = 0x07 // opaque metadata passed to EmbedMessage
+	tlvKeyCheck      = 0x08 // 4 byte key check value, present when keys were derived from a stego key
+	tlvDirectory     = 0x09 // entries of a multi-file payload
+	tlvShard         = 0x0A // position of this container in a secret split across several covers
+	tlvShare         = 0x0B // index and threshold of this container in a threshold-shared secret
+	tlvRecipients    = 0x0C // file key wrapped for every recipient public key
+	tlvSigner        = 0x0D // Ed25519 public key of the sender, the signature follows the payload
+	tlvDSSSGain      = 0x0E // float64 gain the DSSS chips were added with
+)
+
+const shardSetIDSize = 16 // size of the random set id of shard and share sets
+
+// shardInfo places a container in a shard set. Sequence numbers start at 1.
+type shardInfo struct {
+	setID [shardSetIDSize]byte
+	seq   int
+	count int
+}
+
+// shareInfo places a container in a share set: any threshold of the count shares recover the
+// secret. Share indices start at 1 and are the x coordinates of the Shamir shares.
+type shareInfo struct {
+	setID     [shardSetIDSize]byte
+	index     int
+	threshold int
+	count     int
+}
+
+// containerHeader holds the fields of a v3 header. Optional TLV fields are omitted when zero.
+type containerHeader struct {
+	method        int
+	nLsb          int
+	flags         byte
+	filename      string
+	payloadLen    int
+	originalSize  int64
+	mimeType      string
+	createdAt     time.Time
+	cipherID      int
+	compressionID int
+	eccParams     []byte
+	userMetadata  []byte
+	keyCheck      []byte
+	directory     []byte
+	shard         *shardInfo
+	share         *shareInfo
+	recipients    [][]byte // one wrapped file key stanza per recipient
+	signer        []byte   // Ed25519 public key the container is signed with
+	dsssGain      float64
+}
+
+// encryptedFlag reports whether the payload was encrypted
+func (h *containerHeader) encryptedFlag() bool {
+	return h.flags&(1<<0) != 0
+}
+
+// signatureLen returns the size of the signature between payload and integrity tag
+func (h *containerHeader) signatureLen() int {
+	if len(h.signer) > 0 {
+		return signatureSize
+	}
+	return 0
+}
+
+// encode serialises the header including its trailing CRC32
+func (h *containerHeader) encode() ([]byte, error) {
+	var tlv bytes.Buffer
+	if h.originalSize > 0 {
+		writeTLV(&tlv, tlvOriginalSize, binary.BigEndian.AppendUint64(nil, uint64(h.originalSize)))
+	}
+	if h.mimeType != "" {
+		writeTLV(&tlv, tlvMimeType, []byte(h.mimeType))
+	}
+	if !h.createdAt.IsZero() {
+		writeTLV(&tlv, tlvCreatedAt, binary.BigEndian.AppendUint64(nil, uint64(h.createdAt.Unix())))
+	}
+	if h.encryptedFlag() {
+		writeTLV(&tlv, tlvCipherID, []byte{byte(h.cipherID)})
+	}
+	if h.compressionID != 0 {
+		writeTLV(&tlv, tlvCompressionID, []byte{byte(h.compressionID)})
+	}
+	if len(h.eccParams) > 0 {
+		writeTLV(&tlv, tlvECCParams, h.eccParams)
+	}
+	if len(h.userMetadata) > 0 {
+		writeTLV(&tlv, tlvUserMetadata, h.userMetadata)
+	}
+	if len(h.keyCheck) > 0 {
+		writeTLV(&tlv, tlvKeyCheck, h.keyCheck)
+	}
+	if len(h.directory) > 0 {
+		writeTLV(&tlv, tlvDirectory, h.directory)
+	}
+	if h.shard != nil {
+		value := append([]byte(nil), h.shard.setID[:]...)
+		value = binary.BigEndian.AppendUint16(value, uint16(h.shard.seq))
+		value = binary.BigEndian.AppendUint16(value, uint16(h.shard.count))
+		writeTLV(&tlv, tlvShard, value)
+	}
+	if h.share != nil {
+		value := append([]byte(nil), h.share.setID[:]...)
+		value = append(value, byte(h.share.index), byte(h.share.threshold), byte(h.share.count))
+		writeTLV(&tlv, tlvShare, value)
+	}
+	if len(h.recipients) > 0 {
+		value := []byte{byte(len(h.recipients))}
+		for _, stanza := range h.recipients {
+			value = append(value, stanza...)
+		}
+		writeTLV(&tlv, tlvRecipients, value)
+	}
+	if len(h.signer) > 0 {
+		writeTLV(&tlv, tlvSigner, h.signer)
+	}
+	if h.dsssGain != 0 {
+		writeTLV(&tlv, tlvDSSSGain, binary.BigEndian.AppendUint64(nil, math.Float64bits(h.dsssGain)))
+	}
+
+	if len(h.filename) > 0xFFFF || tlv.Len() > 0xFFFF || h.payloadLen > 0xFFFFFFFF {
+		return nil, models.ErrFileTooLarge
+	}
+
+	buf := bytes.Buffer{}
+	buf.Write(magicV3)
+	buf.WriteByte(containerVersion)
+	buf.WriteByte(byte(h.method))
+	buf.WriteByte(byte(h.nLsb))
+	buf.WriteByte(h.flags)
+	binary.Write(&buf, binary.BigEndian, uint16(len(h.filename)))
+	binary.Write(&buf, binary.BigEndian, uint32(h.payloadLen))
+	binary.Write(&buf, binary.BigEndian, uint16(tlv.Len()))
+	buf.WriteString(h.filename)
+	buf.Write(tlv.Bytes())
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+// writeTLV appends one TLV field. Values longer than 0xFFFF are rejected by encode through the
+// block length check, so the length is simply truncated here.
+func writeTLV(buf *bytes.Buffer, typ byte, value []byte) {
+	buf.WriteByte(typ)
+	binary.Write(buf, binary.BigEndian, uint16(len(value)))
+	buf.Write(value)
+}
+
+// readContainerHeader reads a v3 header at the start of src and returns it with the byte offset of
+// the payload. Returns ErrExtractionFailed if there is no v3 header in src and ErrCorruptedData if
+// the header is present but fails its CRC.
+func readContainerHeader(src byteSource) (*containerHeader, int, error) {
+	fixed := src.readAt(0, containerFixedSize)
+	if fixed == nil || !bytes.Equal(fixed[0:6], magicV3) || fixed[6] != containerVersion {
+		return nil, 0, models.ErrExtractionFailed
+	}
+
+	h := &containerHeader{
+		method:     int(fixed[7]),
+		nLsb:       int(fixed[8]),
+		flags:      fixed[9],
+		payloadLen: int(binary.BigEndian.Uint32(fixed[12:16])),
+	}
+	filenameLen := int(binary.BigEndian.Uint16(fixed[10:12]))
+	tlvLen := int(binary.BigEndian.Uint16(fixed[16:18]))
+
+	// filename, TLV block and CRC; if the lengths exceed the capacity this is not a container
+	rest := src.readAt(containerFixedSize, filenameLen+tlvLen+4)
+	if rest == nil {
+		return nil, 0, models.ErrExtractionFailed
+	}
+	headerLen := containerFixedSize + filenameLen + tlvLen
+	crc := crc32.NewIEEE()
+	crc.Write(fixed)
+	crc.Write(rest[:filenameLen+tlvLen])
+	if crc.Sum32() != binary.BigEndian.Uint32(rest[filenameLen+tlvLen:]) {
+		return nil, 0, models.ErrCorruptedData
+	}
+
+	h.filename = string(rest[:filenameLen])
+	if err := h.decodeTLV(rest[filenameLen : filenameLen+tlvLen]); err != nil {
+		return nil, 0, err
+	}
+	return h, headerLen + 4, nil
+}
+
+// decodeTLV parses the TLV block into the optional header fields, skipping unknown types
+func (h *containerHeader) decodeTLV(block []byte) error {
+	for len(block) > 0 {
+		if len(block) < 3 {
+			return models.ErrCorruptedData
+		}
+		typ, n := block[0], int(binary.BigEndian.Uint16(block[1:3]))
+		if len(block) < 3+n {
+			return models.ErrCorruptedData
+		}
+		value := block[3 : 3+n]
+		block = block[3+n:]
+
+		switch {
+		case typ == tlvOriginalSize && n == 8:
+			h.originalSize = int64(binary.BigEndian.Uint64(value))
+		case typ == tlvMimeType:
+			h.mimeType = string(value)
+		case typ == tlvCreatedAt && n == 8:
+			h.createdAt = time.Unix(int64(binary.BigEndian.Uint64(value)), 0).UTC()
+		case typ == tlvCipherID && n == 1:
+			h.cipherID = int(value[0])
+		case typ == tlvCompressionID && n == 1:
+			h.compressionID = int(value[0])
+		case typ == tlvECCParams:
+			h.eccParams = value
+		case typ == tlvUserMetadata:
+			h.userMetadata = value
+		case typ == tlvKeyCheck:
+			h.keyCheck = value
+		case typ == tlvDirectory:
+			h.directory = value
+		case typ == tlvShard && n == shardSetIDSize+4:
+			h.shard = &shardInfo{
+				seq:   int(binary.BigEndian.Uint16(value[shardSetIDSize:])),
+				count: int(binary.BigEndian.Uint16(value[shardSetIDSize+2:])),
+			}
+			copy(h.shard.setID[:], value)
+		case typ == tlvShare && n == shardSetIDSize+3:
+			h.share = &shareInfo{
+				index:     int(value[shardSetIDSize]),
+				threshold: int(value[shardSetIDSize+1]),
+				count:     int(value[shardSetIDSize+2]),
+			}
+			copy(h.share.setID[:], value)
+		case typ == tlvRecipients && n > 0 && n == 1+int(value[0])*recipientStanzaSize:
+			h.recipients = nil
+			for stanzas := value[1:]; len(stanzas) > 0; stanzas = stanzas[recipientStanzaSize:] {
+				h.recipients = append(h.recipients, stanzas[:recipientStanzaSize])
+			}
+		case typ == tlvSigner && n == ed25519.PublicKeySize:
+			h.signer = value
+		case typ == tlvDSSSGain && n == 8:
+			h.dsssGain = math.Float64frombits(binary.BigEndian.Uint64(value))
+		}
+	}
+	return nil
+}
+
+// integrityTag authenticates the header and payload bytes. With derived keys it is an HMAC under the
+// integrity subkey, so it cannot be recomputed without the stego key; otherwise a plain SHA-256 still
+// catches damage that the header CRC does not cover.
+func integrityTag(keys *DerivedKeys, data []byte) []byte {
+	if keys == nil {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+	mac := hmac.New(sha256.New, keys.Integrity)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// keyCheckValue returns the short value stored in the header to recognise a wrong stego key
+func keyCheckValue(keys *DerivedKeys) []byte {
+	mac := hmac.New(sha256.New, keys.Integrity)
+	mac.Write([]byte("astego key check"))
+	return mac.Sum(nil)[:keyCheckSize]
+}
+
+// packEntries concatenates the files of a multi-file payload and encodes their directory
+func packEntries(entries []models.SecretEntry) (payload []byte, directory []byte, err error) {
+	for _, e := range entries {
+		if len(e.Name) > 0xFFFF || len(e.Data) > 0xFFFFFFFF {
+			return nil, nil, models.ErrFileTooLarge
+		}
+		directory = binary.BigEndian.AppendUint16(directory, uint16(len(e.Name)))
+		directory = append(directory, e.Name...)
+		directory = binary.BigEndian.AppendUint32(directory, uint32(len(e.Data)))
+		directory = binary.BigEndian.AppendUint64(directory, uint64(e.ModTime.Unix()))
+		payload = append(payload, e.Data...)
+	}
+	return payload, directory, nil
+}
+
+// unpackEntries splits a multi-file payload along its directory. The sizes must add up to the
+// payload length exactly.
+func unpackEntries(directory []byte, payload []byte) ([]models.SecretEntry, error) {
+	var entries []models.SecretEntry
+	offset := 0
+	for len(directory) > 0 {
+		if len(directory) < 2 {
+			return nil, models.ErrCorruptedData
+		}
+		nameLen := int(binary.BigEndian.Uint16(directory[0:2]))
+		if len(directory) < 2+nameLen+4+8 {
+			return nil, models.ErrCorruptedData
+		}
+		name := string(directory[2 : 2+nameLen])
+		size := int(binary.BigEndian.Uint32(directory[2+nameLen:]))
+		modTime := time.Unix(int64(binary.BigEndian.Uint64(directory[2+nameLen+4:])), 0).UTC()
+		directory = directory[2+nameLen+4+8:]
+
+		if size > len(payload)-offset {
+			return nil, models.ErrCorruptedData
+		}
+		entries = append(entries, models.SecretEntry{Name: name, Size: size, ModTime: modTime, Data: payload[offset : offset+size]})
+		offset += size
+	}
+	if offset != len(payload) {
+		return nil, models.ErrCorruptedData
+	}
+	return entries, nil
+}
@@ -1,7 +1,51 @@
 package service
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
 	"log"
+	"strings"
+	"time"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+	"golang.org/x/crypto/argon2"
+)
+
+// DerivedKeys holds the independent subkeys derived from a stego key.
+// Each subkey is 32 bytes and is only ever used for its own purpose.
+type DerivedKeys struct {
+	Encryption []byte // encrypts the secret payload
+	Position   []byte // seeds the selection of carrier positions
+	Integrity  []byte // authenticates the embedded data
+	Header     []byte // whitens hidden container headers
+}
+
+// Recipient keys are X25519 keys written as text: a public key is publicKeyPrefix followed by the
+// unpadded base64url encoding of its 32 bytes, a private key the same with privateKeyPrefix. A file
+// key is wrapped for a recipient into a stanza of an ephemeral public key and the file key sealed
+// with AES-256-GCM under HKDF-SHA256 of the X25519 shared secret.
+const (
+	publicKeyPrefix     = "astego-pub-"
+	privateKeyPrefix    = "ASTEGO-SECRET-KEY-"
+	fileKeySize         = 16
+	recipientStanzaSize = 32 + fileKeySize + 16 // ephemeral public key, sealed file key, GCM tag
+)
+
+// Signing keys are Ed25519 keys in the same text encoding: the public key with signerKeyPrefix,
+// the 32-byte private key seed with signingKeyPrefix.
+const (
+	signerKeyPrefix  = "astego-signer-"
+	signingKeyPrefix = "ASTEGO-SIGNING-KEY-"
+	signatureSize    = ed25519.SignatureSize
 )
 
 // cryptographyService implements the CryptographyService interface
@@ -12,7 +56,8 @@ func NewCryptographyService() CryptographyService {
 	return &cryptographyService{}
 }
 
-// VigenereCipher performs XOR-based encryption/decryption using a repeating key
+// VigenereCipher performs extended Vigenère encryption/decryption over the 256-symbol byte alphabet:
+// C[i] = (P[i] + K[i mod m]) mod 256 and P[i] = (C[i] - K[i mod m]) mod 256
 func (c *cryptographyService) VigenereCipher(data []byte, key string, encrypt bool) []byte {
 	if len(key) == 0 {
 		log.Printf("[WARN] VigenereCipher: Empty key provided, returning data unchanged")
@@ -29,12 +74,283 @@ func (c *cryptographyService) VigenereCipher(data []byte, key string, encrypt bo
 	result := make([]byte, len(data))
 	keyBytes := []byte(key)
 
-	// XOR each byte of data with repeating key
+	// Shift each byte of data by the repeating key (byte arithmetic wraps modulo 256)
 	for i, b := range data {
 		keyByte := keyBytes[i%len(keyBytes)]
-		result[i] = b ^ keyByte
+		if encrypt {
+			result[i] = b + keyByte
+		} else {
+			result[i] = b - keyByte
+		}
 	}
 
 	log.Printf("[DEBUG] VigenereCipher: Successfully processed %d bytes", len(result))
 	return result
 }
+
+// XORCipher performs repeating-key XOR. It is only kept to decrypt stego files created before the
+// extended Vigenère cipher was introduced; new embeddings never use it.
+func (c *cryptographyService) XORCipher(data []byte, key string) []byte {
+	if len(key) == 0 {
+		return data
+	}
+	result := make([]byte, len(data))
+	keyBytes := []byte(key)
+	for i, b := range data {
+		result[i] = b ^ keyBytes[i%len(keyBytes)]
+	}
+	return result
+}
+
+// AESGCMEncrypt encrypts plaintext with AES-256-GCM using a 32-byte key.
+// The output is nonce (12 bytes) || ciphertext || tag (16 bytes).
+func (c *cryptographyService) AESGCMEncrypt(plaintext []byte, key []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	log.Printf("[DEBUG] AESGCMEncrypt: encrypting %d bytes", len(plaintext))
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// AESGCMDecrypt decrypts and authenticates data produced by AESGCMEncrypt
+func (c *cryptographyService) AESGCMDecrypt(ciphertext []byte, key []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("ciphertext too short: %d bytes", len(ciphertext))
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	log.Printf("[DEBUG] AESGCMDecrypt: decrypting %d bytes", len(sealed))
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+// DeriveKeys stretches the stego key with Argon2id and expands the result with HKDF-SHA256 into
+// separate encryption, position, integrity and header subkeys
+func (c *cryptographyService) DeriveKeys(password string, salt []byte, params models.KDFParams) (*DerivedKeys, error) {
+	if !params.IsValid() {
+		return nil, models.ErrInvalidKDFParams
+	}
+
+	log.Printf("[DEBUG] DeriveKeys: Argon2id t=%d m=%dMiB p=%d salt=%d bytes",
+		params.Time, params.MemoryMiB, params.Threads, len(salt))
+	master := argon2.IDKey([]byte(password), salt, uint32(params.Time), uint32(params.MemoryMiB)*1024, params.Threads, 32)
+
+	keys := &DerivedKeys{}
+	for _, sub := range []struct {
+		out  *[]byte
+		info string
+	}{
+		{&keys.Encryption, "astego encryption key"},
+		{&keys.Position, "astego position key"},
+		{&keys.Integrity, "astego integrity key"},
+		{&keys.Header, "astego header key"},
+	} {
+		key, err := hkdf.Key(sha256.New, master, salt, sub.info, 32)
+		if err != nil {
+			return nil, err
+		}
+		*sub.out = key
+	}
+	return keys, nil
+}
+
+// DeriveFileKeys expands a random file key with HKDF-SHA256 into the encryption and integrity
+// subkeys of a secret encrypted to recipients. Position and Header stay nil, the layout is still
+// keyed by the stego key if one is given.
+func (c *cryptographyService) DeriveFileKeys(fileKey []byte) (*DerivedKeys, error) {
+	keys := &DerivedKeys{}
+	var err error
+	if keys.Encryption, err = hkdf.Key(sha256.New, fileKey, nil, "astego file encryption key", 32); err != nil {
+		return nil, err
+	}
+	if keys.Integrity, err = hkdf.Key(sha256.New, fileKey, nil, "astego file integrity key", 32); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GenerateKeyPair creates a new X25519 recipient key pair in its text encoding
+func (c *cryptographyService) GenerateKeyPair() (*models.KeyPair, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &models.KeyPair{
+		PublicKey:  publicKeyPrefix + base64.RawURLEncoding.EncodeToString(private.PublicKey().Bytes()),
+		PrivateKey: privateKeyPrefix + base64.RawURLEncoding.EncodeToString(private.Bytes()),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// ParseRecipients reads public keys from text, one per line, skipping blank lines and '#' comments.
+// Private key lines are rejected, so an identity file written by GenerateKeyPair's IdentityFile is
+// not a recipients file: its public key is only a comment.
+func (c *cryptographyService) ParseRecipients(data []byte) ([][]byte, error) {
+	return parseKeyLines(data, publicKeyPrefix, models.ErrInvalidRecipient)
+}
+
+// ParseIdentities reads private keys from an identity file or text, one per line, skipping blank
+// lines and '#' comments
+func (c *cryptographyService) ParseIdentities(data []byte) ([][]byte, error) {
+	return parseKeyLines(data, privateKeyPrefix, models.ErrInvalidIdentity)
+}
+
+// WrapFileKey encrypts fileKey for the holder of the private key matching publicKey
+func (c *cryptographyService) WrapFileKey(fileKey []byte, publicKey []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, models.ErrInvalidRecipient
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, models.ErrInvalidRecipient
+	}
+	aead, err := newWrapAEAD(shared, ephemeral.PublicKey().Bytes(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+	// every wrapping key is used once, a zero nonce is safe
+	return aead.Seal(ephemeral.PublicKey().Bytes(), make([]byte, aead.NonceSize()), fileKey, nil), nil
+}
+
+// UnwrapFileKey recovers the file key from a stanza made by WrapFileKey. It fails if the stanza
+// was made for a different recipient.
+func (c *cryptographyService) UnwrapFileKey(stanza []byte, privateKey []byte) ([]byte, error) {
+	if len(stanza) != recipientStanzaSize {
+		return nil, fmt.Errorf("recipient stanza must be %d bytes, got %d", recipientStanzaSize, len(stanza))
+	}
+	identity, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, models.ErrInvalidIdentity
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(stanza[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := identity.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newWrapAEAD(shared, stanza[:32], identity.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, make([]byte, aead.NonceSize()), stanza[32:], nil)
+}
+
+// GenerateSigningKeyPair creates a new Ed25519 signing key pair in its text encoding
+func (c *cryptographyService) GenerateSigningKeyPair() (*models.KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &models.KeyPair{
+		PublicKey:  formatSignerKey(public),
+		PrivateKey: signingKeyPrefix + base64.RawURLEncoding.EncodeToString(private.Seed()),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// ParseSigningKey reads the single signing key of a key file or text and returns its seed
+func (c *cryptographyService) ParseSigningKey(data []byte) ([]byte, error) {
+	keys, err := parseKeyLines(data, signingKeyPrefix, models.ErrInvalidSigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != 1 {
+		return nil, models.ErrInvalidSigningKey
+	}
+	return keys[0], nil
+}
+
+// ParseSigners reads trusted signer public keys from text, one per line, skipping blank lines and
+// '#' comments
+func (c *cryptographyService) ParseSigners(data []byte) ([][]byte, error) {
+	return parseKeyLines(data, signerKeyPrefix, models.ErrInvalidSigner)
+}
+
+// SignerPublicKey returns the Ed25519 public key of a signing key seed
+func (c *cryptographyService) SignerPublicKey(signingKey []byte) ([]byte, error) {
+	if len(signingKey) != ed25519.SeedSize {
+		return nil, models.ErrInvalidSigningKey
+	}
+	return ed25519.NewKeyFromSeed(signingKey).Public().(ed25519.PublicKey), nil
+}
+
+// Sign signs data with the Ed25519 key of the given seed
+func (c *cryptographyService) Sign(data []byte, signingKey []byte) ([]byte, error) {
+	if len(signingKey) != ed25519.SeedSize {
+		return nil, models.ErrInvalidSigningKey
+	}
+	return ed25519.Sign(ed25519.NewKeyFromSeed(signingKey), data), nil
+}
+
+// Verify reports whether signature is a valid Ed25519 signature of data by publicKey
+func (c *cryptographyService) Verify(data []byte, signature []byte, publicKey []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize || len(signature) != signatureSize {
+		return false
+	}
+	return ed25519.Verify(publicKey, data, signature)
+}
+
+// formatSignerKey returns the text encoding of a signer public key, which identifies the signer
+func formatSignerKey(publicKey []byte) string {
+	return signerKeyPrefix + base64.RawURLEncoding.EncodeToString(publicKey)
+}
+
+// newWrapAEAD derives the key wrapping a file key from an X25519 shared secret, bound to both
+// public keys involved
+func newWrapAEAD(shared, ephemeralPublic, recipientPublic []byte) (cipher.AEAD, error) {
+	salt := append(append([]byte(nil), ephemeralPublic...), recipientPublic...)
+	key, err := hkdf.Key(sha256.New, shared, salt, "astego x25519 file key", 32)
+	if err != nil {
+		return nil, err
+	}
+	return newAESGCM(key)
+}
+
+// parseKeyLines decodes every key line with the given prefix into its 32 raw bytes
+func parseKeyLines(data []byte, prefix string, errInvalid error) ([][]byte, error) {
+	var keys [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(line, prefix))
+		if !strings.HasPrefix(line, prefix) || err != nil || len(raw) != 32 {
+			return nil, errInvalid
+		}
+		keys = append(keys, raw)
+	}
+	if err := scanner.Err(); err != nil || len(keys) == 0 {
+		return nil, errInvalid
+	}
+	return keys, nil
+}
+
+// newAESGCM creates an AES-256-GCM AEAD from a 32-byte key
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("AES-256 key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+/*
+ DCT coefficient embedding: every channel is cut into blocks of dctBlock samples, and bit j of a
+ block sits in the mid-frequency coefficient dctBandStart+j of its orthonormal DCT-II (about 1.4 to
+ 4.1 kHz at 44.1 kHz, above the loudest bass and below the hiss the ear is most sensitive to). A 0
+ moves the coefficient to the nearest even multiple of dctStep, a 1 to the nearest odd multiple, so
+ it reads back unless noise moves it by half a step; spread over the block, that is far more noise
+ per sample than any LSB survives.
+
+ Only band coefficients change, so the inverse transform just adds their changes times the basis
+ vectors. Where that pushes samples past the 16-bit range, the block is clipped and the band
+ coefficients are quantized again, for up to dctClipPasses rounds, which settles loud blocks on a
+ clip-free signal that still carries the bits.
+
+ The band is computed with one FFT of the block (Makhoul's reordering of the DCT-II), and reading
+ keeps the band of every block it transformed, so a block costs one transform however many of its
+ bits are read.
+*/
+
+const (
+	dctBlock      = 1024 // samples per channel in a block
+	dctBandStart  = 64   // first coefficient carrying a bit
+	dctBandSize   = 128  // coefficients per block carrying a bit
+	dctStep       = 64   // quantization step of the band coefficients
+	dctClipPasses = 4    // most rounds of quantizing the band again after clipping
+)
+
+// dctCarrier stores one bit per mid-frequency DCT coefficient of every block and channel. Bits are
+// collected and the blocks rewritten from the cover samples once all bits are set.
+type dctCarrier struct {
+	signal *pcmSignal
+	basis  [][]float64 // orthonormal DCT-II basis vector of every band coefficient
+	band   [][]float64 // band of every block and channel read so far, nil until read
+	bits   []int8      // bit of every slot, -1 while unset; nil until a bit is set
+	dirty  bool
+}
+
+// newDCTCarrier prepares the band of the DCT of signal
+func newDCTCarrier(signal *pcmSignal) *dctCarrier {
+	basis := make([][]float64, dctBandSize)
+	for j := range basis {
+		k := float64(dctBandStart + j)
+		basis[j] = make([]float64, dctBlock)
+		for n := range basis[j] {
+			basis[j][n] = math.Sqrt(2.0/dctBlock) * math.Cos(math.Pi*(float64(n)+0.5)*k/dctBlock)
+		}
+	}
+	return &dctCarrier{signal: signal, basis: basis}
+}
+
+func (c *dctCarrier) capacity() int {
+	return c.signal.frames / dctBlock * c.signal.channels * dctBandSize
+}
+
+func (c *dctCarrier) bit(slot int) uint8 {
+	index := slot / dctBandSize
+	if c.band == nil {
+		c.band = make([][]float64, c.capacity()/dctBandSize)
+	}
+	if c.band[index] == nil {
+		start, ch, _ := c.locate(slot)
+		block := make([]float64, dctBlock)
+		for n := range block {
+			block[n] = c.signal.sample(start+n, ch)
+		}
+		c.band[index] = dctBand(block)
+	}
+	return uint8(int64(math.Round(c.band[index][slot%dctBandSize]/dctStep)) & 1)
+}
+
+func (c *dctCarrier) setBit(slot int, bit uint8) {
+	if c.bits == nil {
+		c.bits = make([]int8, c.capacity())
+		for i := range c.bits {
+			c.bits[i] = -1
+		}
+	}
+	c.bits[slot] = int8(bit)
+	c.dirty = true
+}
+
+// flush rewrites every block and channel holding a bit from the cover samples with its band
+// coefficients quantized
+func (c *dctCarrier) flush() {
+	if !c.dirty {
+		return
+	}
+	block := make([]float64, dctBlock)
+	targets := make([]float64, dctBandSize)
+	for first := 0; first < len(c.bits); first += dctBandSize {
+		bits := c.bits[first : first+dctBandSize]
+		start, ch, _ := c.locate(first)
+		var coeffs []float64
+		for j, bit := range bits {
+			if bit < 0 {
+				continue
+			}
+			if coeffs == nil {
+				for n := range block {
+					block[n] = c.signal.originalSample(start+n, ch)
+				}
+				coeffs = dctBand(block)
+			}
+			// nearest multiple of the step with the parity of the bit
+			offset := float64(bit) * dctStep
+			targets[j] = math.Round((coeffs[j]-offset)/(2*dctStep))*2*dctStep + offset
+		}
+		if coeffs == nil {
+			continue
+		}
+
+		for pass := 0; pass < dctClipPasses; pass++ {
+			if pass > 0 {
+				coeffs = dctBand(block)
+			}
+			for j, bit := range bits {
+				if bit >= 0 {
+					delta := targets[j] - coeffs[j]
+					for n, b := range c.basis[j] {
+						block[n] += delta * b
+					}
+				}
+			}
+			clipped := false
+			for n, v := range block {
+				if v > math.MaxInt16 || v < math.MinInt16 {
+					block[n] = math.Max(math.MinInt16, math.Min(math.MaxInt16, v))
+					clipped = true
+				}
+			}
+			if !clipped {
+				break
+			}
+		}
+		for n, v := range block {
+			c.signal.setSample(start+n, ch, v)
+		}
+	}
+	c.band = nil
+	c.dirty = false
+}
+
+// locate returns the first frame and the channel of the block holding slot, and its coefficient
+// in the band
+func (c *dctCarrier) locate(slot int) (start, ch, j int) {
+	index := slot / dctBandSize
+	return index / c.signal.channels * dctBlock, index % c.signal.channels, slot % dctBandSize
+}
+
+// dctBand returns the band coefficients of the orthonormal DCT-II of a block. The even samples in
+// order followed by the odd samples reversed have an FFT whose bin k, rotated by -πk/2N, has the
+// DCT coefficient k as its real part.
+func dctBand(block []float64) []float64 {
+	x := make([]complex128, dctBlock)
+	for n := 0; n < dctBlock/2; n++ {
+		x[n] = complex(block[2*n], 0)
+		x[dctBlock-1-n] = complex(block[2*n+1], 0)
+	}
+	fft(x, false)
+	band := make([]float64, dctBandSize)
+	for j := range band {
+		k := float64(dctBandStart + j)
+		band[j] = math.Sqrt(2.0/dctBlock) * real(x[dctBandStart+j]*cmplx.Rect(1, -math.Pi*k/(2*dctBlock)))
+	}
+	return band
+}
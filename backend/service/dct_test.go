@@ -0,0 +1,25 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+// The FFT-based band transform gives the same coefficients as the orthonormal DCT-II basis
+func TestDCTBandMatchesBasis(t *testing.T) {
+	signal, err := newPCMSignal(testWAV(dctBlock, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newDCTCarrier(signal)
+	block := signal.mix(0, dctBlock)
+	for j, got := range dctBand(block) {
+		var want float64
+		for n, b := range c.basis[j] {
+			want += block[n] * b
+		}
+		if math.Abs(got-want) > 1e-6 {
+			t.Fatalf("coefficient %d: got %f, want %f", dctBandStart+j, got, want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"crypto/rand"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+/*
+ Deniable embedding: two containers share one cover under two different stego keys. Both layers use
+ the same hidden key preamble (a random salt, see layout.go), from which each key derives its own
+ subkeys. The slots after the preamble are split into two halves and each layer scatters its
+ container along its keyed permutation over one half, whitened with its header subkey; which half
+ holds the decoy is chosen at random. Every slot of both halves that no container uses is filled
+ with random bits first, so a half without a container looks exactly like one with a container
+ under an unknown key. A key therefore reveals its own layer only, and the decoy key proves
+ nothing about the other half - also when it was left empty on purpose.
+*/
+
+const deniableLayers = 2
+
+// layerLayout returns the layout of one layer of a deniable embedding: its half of the slots after
+// the preamble, in the order of the keyed permutation
+func layerLayout(preambleBits, totalBits, layer int, keys *DerivedKeys, mask *keystream) bitLayout {
+	size := (totalBits - preambleBits) / deniableLayers
+	return bitLayout{
+		regionStart: preambleBits + layer*size,
+		regionSize:  size,
+		perm:        newKeyedPermutation(keys.Position, size),
+		mask:        mask,
+	}
+}
+
+// EmbedDeniable embeds decoyData under decoy.StegoKey and hiddenData under hidden.StegoKey into two
+// layers of decoy.CoverAudio. The hidden layer shares the cover, method, ECC level and KDF cost of
+// the decoy; its other options are its own. hidden may be nil, the second layer then only holds
+// random bits. Both layers are always scattered behind a hidden header.
+func (s *stegoService) EmbedDeniable(decoy *models.EmbedRequest, decoyData []byte, hidden *models.EmbedRequest, hiddenData []byte) ([]byte, models.Distortion, error) {
+	// a keyed carrier only reads back under the stego key of one layer
+	if decoy.Method.IsKeyed() {
+		return nil, models.Distortion{}, models.ErrDeniableMethod
+	}
+	layers, secrets := []*models.EmbedRequest{decoy}, [][]byte{decoyData}
+	if hidden != nil {
+		if hidden.StegoKey == decoy.StegoKey {
+			return nil, models.Distortion{}, models.ErrDeniableKeys
+		}
+		layer := *hidden
+		layer.CoverAudio, layer.DecodeToPCM = decoy.CoverAudio, decoy.DecodeToPCM
+		layer.Method, layer.NLsb, layer.ECC, layer.KDF = decoy.Method, decoy.NLsb, decoy.ECC, decoy.KDF
+		layers, secrets = append(layers, &layer), append(secrets, hiddenData)
+	}
+
+	headers := make([]*containerHeader, len(layers))
+	payloads := make([][]byte, len(layers))
+	for i, layer := range layers {
+		if layer.StegoKey == "" || layer.PublicHeader {
+			return nil, models.Distortion{}, models.ErrDeniableKeys
+		}
+		req := *layer
+		req.UseScatter, req.UseRandomStart = true, false
+		layers[i] = &req
+		if err := validateEmbedRequest(&req); err != nil {
+			return nil, models.Distortion{}, err
+		}
+		var err error
+		if headers[i], payloads[i], err = prepareSecret(&req, secrets[i], nil); err != nil {
+			return nil, models.Distortion{}, err
+		}
+	}
+
+	coverAudio, err := s.coverAudio(decoy)
+	if err != nil {
+		return nil, models.Distortion{}, err
+	}
+	cover := make([]byte, len(coverAudio))
+	copy(cover, coverAudio)
+	payloadIdxs, err := collectCoverIndices(cover)
+	if err != nil {
+		return nil, models.Distortion{}, err
+	}
+	carrier, err := newCarrier(cover, payloadIdxs, decoy.Method, headers[0].nLsb, decoy.StegoKey, dsssParams(decoy).Gain)
+	if err != nil {
+		return nil, models.Distortion{}, err
+	}
+
+	// Both layers derive their subkeys from the same salt in the shared preamble
+	salt := make([]byte, keySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, models.Distortion{}, err
+	}
+	preamble := keyPreamble(decoy, salt)
+	totalCapacityBits := carrier.capacity()
+	preambleBits := len(preamble) * 8
+	if preambleBits > totalCapacityBits {
+		return nil, models.Distortion{}, models.ErrInsufficientCapacity
+	}
+
+	// Every slot after the preamble starts out random
+	region := bitLayout{regionStart: preambleBits, regionSize: totalCapacityBits - preambleBits}
+	noise := make([]byte, (region.regionSize+7)/8)
+	if _, err := rand.Read(noise); err != nil {
+		return nil, models.Distortion{}, err
+	}
+	region.writeBits(carrier, bytesToBits(noise)[:region.regionSize])
+
+	// The decoy goes into a random half, the hidden layer into the other
+	var first [1]byte
+	if _, err := rand.Read(first[:]); err != nil {
+		return nil, models.Distortion{}, err
+	}
+	for i, req := range layers {
+		container, keys, err := s.sealContainer(req, headers[i], payloads[i], salt)
+		if err != nil {
+			return nil, models.Distortion{}, err
+		}
+		mask, err := newKeystream(keys.Header)
+		if err != nil {
+			return nil, models.Distortion{}, err
+		}
+		layout := layerLayout(preambleBits, totalCapacityBits, (int(first[0])+i)%deniableLayers, keys, mask)
+		if len(container)*8 > layout.regionSize {
+			return nil, models.Distortion{}, models.ErrInsufficientCapacity
+		}
+		layout.writeBytes(carrier, container)
+	}
+
+	bitLayout{regionStart: 0, regionSize: totalCapacityBits}.writeBytes(carrier, preamble)
+	flushCarrier(carrier)
+	return s.finishCover(decoy, coverAudio, cover)
+}
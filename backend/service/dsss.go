@@ -0,0 +1,214 @@
+package service
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"math"
+	"math/cmplx"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+/*
+ Direct-sequence spread spectrum: every bit is spread over a segment of chipRate samples per channel
+ by adding a pseudo-noise sequence of ±1 chips, multiplied by +1 for a 1 and -1 for a 0, at a low
+ amplitude. The chips come from an AES-CTR keystream keyed with the stego key, so only holders of the
+ key can find the signal. A bit is read back by correlating the channel mix with the chips of its
+ segment; both are first differenced, which removes most of the music from the correlation since its
+ energy sits at low frequencies while the chips are white.
+
+ The chip amplitude follows the loudness of every segment (gain times its RMS, but at least
+ dsssMinAmplitude) so the noise stays masked by the music. Embedding is informed: the music itself
+ correlates a little with the chips, and where it works against the bit the amplitude is raised,
+ up to dsssMaxBoost times, until the bit reads back with half the correlation of the chips alone.
+ Reading only looks at the sign of the correlation, so it does not need the gain; the gain is kept
+ in the header for the record.
+
+ More chips per bit (a higher chip rate) make the correlation more reliable and lower the capacity.
+ The base-2 logarithm of the chip rate is spread as one byte over a probe of dsssProbeBits segments
+ of dsssProbeRate samples in front of the slots, so extraction reads it there instead of trying
+ every chip rate; the nLSB byte of the header repeats it. Extraction also finds the probe when the
+ audio picked up up to dsssMaxDelay frames in front of it, as encoders and decoders add, and reads
+ the slots behind it from there. The chips are generated per segment from the keystream, which
+ only keeps them as bits.
+*/
+
+const (
+	dsssMinAmplitude = 4    // chip amplitude in silent segments
+	dsssMaxBoost     = 3    // most the amplitude is raised to overcome the correlation of the music
+	dsssProbeBits    = 8    // bits of the probe holding the chip rate exponent
+	dsssProbeRate    = 8192 // samples per channel spreading one bit of the probe
+	dsssProbeFrames  = dsssProbeBits * dsssProbeRate
+	dsssMaxDelay     = 4096 // most frames the probe is searched for behind the start
+)
+
+// dsssParams returns the spreading parameters of the request
+func dsssParams(req *models.EmbedRequest) models.DSSSParams {
+	if req.DSSS != nil {
+		return *req.DSSS
+	}
+	return models.DefaultDSSSParams()
+}
+
+// dsssSlots returns how many bits of chipRate samples fit in frames after the probe
+func dsssSlots(frames, chipRate int) int {
+	return max(frames-dsssProbeFrames, 0) / chipRate
+}
+
+// dsssCarrier stores one bit per segment of chipRate samples as a pseudo-noise sequence
+type dsssCarrier struct {
+	signal   *pcmSignal
+	stream   *keystream // one chip bit per frame, generated as far as it is read
+	offset   int        // frames in front of the probe, which embedding does not add
+	chipExp  int
+	chipRate int
+	gain     float64
+	probed   bool // whether the probe has been written
+}
+
+// newDSSSCarrier derives the chip sequence for signal from stegoKey; without a key every file uses the
+// same public sequence. gain is only used for embedding.
+func newDSSSCarrier(signal *pcmSignal, chipExp int, stegoKey string, gain float64) (*dsssCarrier, error) {
+	key, err := hkdf.Key(sha256.New, []byte(stegoKey), nil, "astego dsss chips", 32)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newKeystream(key)
+	if err != nil {
+		return nil, err
+	}
+	return &dsssCarrier{signal: signal, stream: stream, chipExp: chipExp, chipRate: 1 << chipExp, gain: gain}, nil
+}
+
+// readDSSSProbe finds the probe of a DSSS stego signal and reads the chip rate exponent from it.
+// The probe may sit up to dsssMaxDelay frames late, as after an encoder padded the start;
+// offset is where it was found. ok is false when the cover has no room for a probe or the probe
+// holds no valid chip rate.
+func readDSSSProbe(cover []byte, stegoKey string) (chipExp, offset int, ok bool) {
+	signal, err := newPCMSignal(cover)
+	if err != nil || signal.frames < dsssProbeFrames {
+		return 0, 0, false
+	}
+	c, err := newDSSSCarrier(signal, 0, stegoKey, 0)
+	if err != nil {
+		return 0, 0, false
+	}
+	// Cross-correlate every probe bit with the differenced mix at each delay. The bits are not
+	// known yet, so the delay is the one where the sum of their magnitudes peaks.
+	delays := min(dsssMaxDelay, signal.frames-dsssProbeFrames) + 1
+	size := 1
+	for size < dsssProbeRate+delays {
+		size <<= 1
+	}
+	corr := make([][]float64, dsssProbeBits)
+	score := make([]float64, delays)
+	for i := range corr {
+		start := i * dsssProbeRate
+		samples := make([]complex128, size)
+		mix := signal.mix(start, min(dsssProbeRate+delays, signal.frames-start))
+		for j := 1; j < len(mix); j++ {
+			samples[j] = complex(mix[j]-mix[j-1], 0)
+		}
+		chips := make([]complex128, size)
+		seq := c.chips(start, dsssProbeRate)
+		for j := 1; j < len(seq); j++ {
+			chips[j] = complex(seq[j]-seq[j-1], 0)
+		}
+		fft(samples, false)
+		fft(chips, false)
+		for j := range samples {
+			samples[j] *= cmplx.Conj(chips[j])
+		}
+		fft(samples, true)
+		corr[i] = make([]float64, delays)
+		for d := range corr[i] {
+			corr[i][d] = real(samples[d])
+			score[d] += math.Abs(corr[i][d])
+		}
+	}
+	for d := range score {
+		if score[d] > score[offset] {
+			offset = d
+		}
+	}
+	for i := range corr {
+		if corr[i][offset] > 0 {
+			chipExp |= 1 << (dsssProbeBits - 1 - i)
+		}
+	}
+	return chipExp, offset, models.IsValidChipRate(1 << chipExp)
+}
+
+func (c *dsssCarrier) capacity() int {
+	return dsssSlots(c.signal.frames-c.offset, c.chipRate)
+}
+
+func (c *dsssCarrier) bit(slot int) uint8 {
+	start := dsssProbeFrames + slot*c.chipRate
+	if dsssCorrelate(c.signal.mix(c.offset+start, c.chipRate), c.chips(start, c.chipRate)) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (c *dsssCarrier) setBit(slot int, bit uint8) {
+	if !c.probed {
+		for i := 0; i < dsssProbeBits; i++ {
+			c.spread(i*dsssProbeRate, dsssProbeRate, uint8(c.chipExp>>(dsssProbeBits-1-i)&1))
+		}
+		c.probed = true
+	}
+	c.spread(dsssProbeFrames+slot*c.chipRate, c.chipRate, bit)
+}
+
+// chips returns the ±1 chips of the n frames from start, counted from the probe
+func (c *dsssCarrier) chips(start, n int) []float64 {
+	first := start / 8
+	random := make([]byte, (start+n+7)/8-first)
+	c.stream.xor(first, random)
+	chips := make([]float64, n)
+	for i := range chips {
+		bit := start + i - 8*first
+		chips[i] = float64(int(random[bit/8]>>(bit%8)&1)*2 - 1)
+	}
+	return chips
+}
+
+// spread adds the chips of the n frames from start to the cover samples with the sign of bit
+func (c *dsssCarrier) spread(start, n int, bit uint8) {
+	chips := c.chips(start, n)
+	mix := make([]float64, n)
+	var energy float64
+	for i := range mix {
+		for ch := 0; ch < c.signal.channels; ch++ {
+			v := c.signal.originalSample(start+i, ch)
+			mix[i] += v / float64(c.signal.channels)
+			energy += v * v
+		}
+	}
+	base := math.Max(c.gain*math.Sqrt(energy/float64(n*c.signal.channels)), dsssMinAmplitude)
+
+	// The chips alone correlate with amplitude times the energy of their differences; raise the
+	// amplitude until the music leaves at least half of that
+	sign := 1.0
+	if bit == 0 {
+		sign = -1
+	}
+	chipEnergy := dsssCorrelate(chips, chips)
+	amplitude := math.Min(math.Max(base, base/2-sign*dsssCorrelate(mix, chips)/chipEnergy), dsssMaxBoost*base)
+	amplitude *= sign
+	for i := range chips {
+		for ch := 0; ch < c.signal.channels; ch++ {
+			c.signal.setSample(start+i, ch, c.signal.originalSample(start+i, ch)+amplitude*chips[i])
+		}
+	}
+}
+
+// dsssCorrelate returns the correlation of the differenced samples with the differenced chips
+func dsssCorrelate(samples, chips []float64) float64 {
+	var corr float64
+	for i := 1; i < len(chips); i++ {
+		corr += (samples[i] - samples[i-1]) * (chips[i] - chips[i-1])
+	}
+	return corr
+}
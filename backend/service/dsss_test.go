@@ -0,0 +1,57 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	mathrand "math/rand"
+	"testing"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// The chip rate comes from the probe and the gain from the header
+func TestDSSSProbe(t *testing.T) {
+	req := models.EmbedRequest{CoverAudio: testWAV(700000, 1), Method: models.MethodDSSS,
+		DSSS: &models.DSSSParams{ChipRate: 256, Gain: 0.05}, StegoKey: "dsss key", KDF: testKDF, ECC: models.ECCMedium}
+	stego, _ := testRoundTrip(t, req, []byte("spread over pseudo-noise chips"))
+	if chipExp, offset, ok := readDSSSProbe(stego, "dsss key"); !ok || chipExp != 8 || offset != 0 {
+		t.Fatalf("probe read %d at %d, %v", chipExp, offset, ok)
+	}
+	result, err := newTestStegoService().ExtractContainer(&models.ExtractRequest{StegoKey: "dsss key", KDF: testKDF}, stego)
+	if err != nil || result.ChipRate != 256 || result.Gain != 0.05 {
+		t.Fatalf("chip rate %d, gain %g, %v", result.ChipRate, result.Gain, err)
+	}
+}
+
+// Extraction finds the probe behind the delay and noise a re-encoding adds
+func TestDSSSDelayedAndNoisy(t *testing.T) {
+	secret := []byte("spread over pseudo-noise chips")
+	req := models.EmbedRequest{CoverAudio: testWAV(700000, 1), Method: models.MethodDSSS,
+		DSSS: &models.DSSSParams{ChipRate: 256, Gain: 0.05}, StegoKey: "dsss key", KDF: testKDF, ECC: models.ECCMedium}
+	stego, _, err := newTestStegoService().EmbedMessage(&req, secret, nil)
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+
+	const delay = 1105 // the start padding of an MP3 encoder and decoder
+	rng := mathrand.New(mathrand.NewSource(3))
+	pcm := pcmRegion(stego)
+	samples := make([]int16, delay+len(pcm)/2)
+	for i := delay; i < len(samples); i++ {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[2*(i-delay):])) + int16(rng.Intn(65)-32)
+	}
+	var data bytes.Buffer
+	binary.Write(&data, binary.LittleEndian, samples)
+	shifted := append(testWAV(len(samples), 1)[:44:44], data.Bytes()...)
+
+	if _, offset, ok := readDSSSProbe(shifted, "dsss key"); !ok || offset != delay {
+		t.Fatalf("probe found at %d, %v", offset, ok)
+	}
+	result, err := newTestStegoService().ExtractContainer(&models.ExtractRequest{StegoKey: "dsss key", KDF: testKDF, Method: models.MethodDSSS}, shifted)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if !bytes.Equal(result.SecretData, secret) {
+		t.Fatal("secret differs")
+	}
+}
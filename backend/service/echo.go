@@ -0,0 +1,86 @@
+package service
+
+import "math"
+
+/*
+ Echo hiding: every segment of echoSegment samples per channel carries one bit as a faint echo of
+ itself, delayed by echoDelayZero samples for a 0 and echoDelayOne samples for a 1, minus an echo
+ of the same strength at the other delay. The two echoes show up in the real cepstrum of the
+ channel mix as a peak at the delay of the bit and a dip at the other, while their sum stays quiet:
+ the music barely changes in 25 samples, so most of the two echoes cancel. The echoes fade in and
+ out over echoRamp samples at the segment edges, so switching delays does not click.
+
+ Embedding is closed-loop: the echoes start at echoAmplitudeStep and are strengthened until the
+ segment reads back with a cepstrum lead of echoMargin, but never past echoMaxAmplitude, which keeps
+ the stego audio above 30 dB PSNR even when every segment needs the most. A few segments the music
+ works strongly against, or that are silent or clipped, then read back wrong; extraction relies on
+ Reed–Solomon error correction for them, which embedding requires (see MinECC).
+*/
+
+const (
+	echoSegment   = 2048 // samples per channel carrying one bit
+	echoRamp      = 128  // samples over which the echo fades in and out
+	echoDelayZero = 50   // echo delay encoding a 0 (about 1.1 ms at 44.1 kHz)
+	echoDelayOne  = 75   // echo delay encoding a 1
+	echoMargin    = 0.05 // cepstrum lead a written bit needs over the other delay
+
+	echoAmplitudeStep = 0.01 // strength the echoes start at and are raised by
+	echoMaxAmplitude  = 0.2  // most strength the echoes are raised to
+)
+
+// echoCarrier stores one bit per segment of the decoded audio as an echo
+type echoCarrier struct {
+	signal *pcmSignal
+}
+
+func (c *echoCarrier) capacity() int {
+	return c.signal.frames / echoSegment
+}
+
+func (c *echoCarrier) bit(slot int) uint8 {
+	if c.lead(slot) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (c *echoCarrier) setBit(slot int, bit uint8) {
+	delay, other, sign := echoDelayZero, echoDelayOne, -1.0
+	if bit == 1 {
+		delay, other, sign = echoDelayOne, echoDelayZero, 1
+	}
+	for amplitude := echoAmplitudeStep; amplitude < echoMaxAmplitude+echoAmplitudeStep/2; amplitude += echoAmplitudeStep {
+		c.writeEcho(slot, delay, other, amplitude)
+		if sign*c.lead(slot) >= echoMargin {
+			return
+		}
+	}
+}
+
+// lead returns how far the cepstrum of the segment peaks higher at the delay of a 1 than at the delay of a 0
+func (c *echoCarrier) lead(slot int) float64 {
+	cepstrum := realCepstrum(c.signal.mix(slot*echoSegment, echoSegment))
+	return cepstrum[echoDelayOne] - cepstrum[echoDelayZero]
+}
+
+// writeEcho rewrites the segment as the original samples plus their echo after delay samples and
+// minus their echo after other samples
+func (c *echoCarrier) writeEcho(slot, delay, other int, amplitude float64) {
+	for i := 0; i < echoSegment; i++ {
+		frame := slot*echoSegment + i
+		gain := amplitude
+		if edge := min(i, echoSegment-1-i); edge < echoRamp {
+			gain *= 0.5 - 0.5*math.Cos(math.Pi*float64(edge)/echoRamp)
+		}
+		for ch := 0; ch < c.signal.channels; ch++ {
+			v := c.signal.originalSample(frame, ch)
+			if frame >= delay {
+				v += gain * c.signal.originalSample(frame-delay, ch)
+			}
+			if frame >= other {
+				v -= gain * c.signal.originalSample(frame-other, ch)
+			}
+			c.signal.setSample(frame, ch, v)
+		}
+	}
+}
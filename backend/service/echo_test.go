@@ -0,0 +1,52 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// An ECC block of 255 bytes needs 2040 segments, about 95 seconds of audio
+const echoTestFrames = 2300 * echoSegment
+
+func TestEchoNeedsECC(t *testing.T) {
+	for _, level := range []models.ECCLevel{"", models.ECCNone, models.ECCLow} {
+		req := models.EmbedRequest{CoverAudio: testWAV(echoTestFrames, 1), Method: models.MethodEcho, ECC: level}
+		if _, _, err := newTestStegoService().EmbedMessage(&req, []byte("secret"), nil); err != models.ErrECCTooLow {
+			t.Fatalf("ECC %q: got %v", level, err)
+		}
+	}
+}
+
+// A cover that already echoes strongly at the delay of a 1 cannot be turned into a 0 within the
+// cap: the echoes stop at echoMaxAmplitude and the bit is left to ECC
+func TestEchoStrengthCap(t *testing.T) {
+	cover, err := newPCMSignal(testWAV(echoSegment, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := echoDelayOne; i < echoSegment; i++ {
+		cover.setSample(i, 0, cover.originalSample(i, 0)+0.5*cover.originalSample(i-echoDelayOne, 0))
+	}
+	signal, err := newPCMSignal(cover.data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &echoCarrier{signal: signal}
+	c.setBit(0, 0)
+	if c.bit(0) != 1 {
+		t.Fatal("the echo of the cover was overcome")
+	}
+
+	// least-squares strength of the written echoes away from the fades
+	var num, den float64
+	for i := echoRamp; i < echoSegment-echoRamp; i++ {
+		echo := signal.originalSample(i-echoDelayZero, 0) - signal.originalSample(i-echoDelayOne, 0)
+		num += (signal.sample(i, 0) - signal.originalSample(i, 0)) * echo
+		den += echo * echo
+	}
+	if amplitude := num / den; math.Abs(amplitude-echoMaxAmplitude) > 0.005 {
+		t.Fatalf("echo strength %.3f, want %.3f", amplitude, echoMaxAmplitude)
+	}
+}
@@ -6,30 +6,114 @@ import (
 
 // SteganographyService defines the interface for steganography operations
 type SteganographyService interface {
-	// CalculateCapacity calculates the embedding capacity for different steganography methods (LSB and Parity)
-	CalculateCapacity(audioData []byte) (*models.CapacityResult, error)
+	// CalculateCapacity calculates the embedding capacity for different steganography methods, for DSSS at the given chip rate
+	CalculateCapacity(audioData []byte, chipRate int) (*models.CapacityResult, error)
+
+	// DecodeToWAV decodes an MP3 file to PCM in a WAV container, leaving WAV input unchanged
+	DecodeToWAV(audioData []byte) ([]byte, error)
+
+	// EstimateSecretSize returns the size of a secret once compressed for embedding
+	EstimateSecretSize(secretData []byte) int
+
+	// SecretFits reports whether a secret fits into the cover of req with the options of req, overhead included
+	SecretFits(req *models.EmbedRequest, secretData []byte) (bool, error)
 
 	// EmbedMessage embeds a secret message into audio data using the specified method
-	EmbedMessage(req *models.EmbedRequest, secretData []byte, metadata []byte) ([]byte, float64, error)
+	EmbedMessage(req *models.EmbedRequest, secretData []byte, metadata []byte) ([]byte, models.Distortion, error)
+
+	// EmbedShards splits a secret across several covers and returns one stego file per cover with its PSNR and SNR
+	EmbedShards(req *models.EmbedRequest, covers [][]byte, secretData []byte, metadata []byte) ([][]byte, []models.Distortion, error)
+
+	// EmbedShares splits a secret into one Shamir share per cover so that any threshold of the stego files recover it
+	EmbedShares(req *models.EmbedRequest, covers [][]byte, secretData []byte, metadata []byte, threshold int) ([][]byte, []models.Distortion, error)
+
+	// EmbedDeniable embeds a decoy and an optional hidden secret into two layers of one cover under different stego keys
+	EmbedDeniable(decoy *models.EmbedRequest, decoyData []byte, hidden *models.EmbedRequest, hiddenData []byte) ([]byte, models.Distortion, error)
 
 	// ExtractMessage extracts a secret message from audio data using auto-detection or specified method
 	ExtractMessage(req *models.ExtractRequest, audioData []byte) ([]byte, string, error)
+
+	// ExtractContainer extracts a secret together with the metadata recorded in its container header
+	ExtractContainer(req *models.ExtractRequest, audioData []byte) (*models.ExtractResponse, error)
+
+	// ExtractShards reassembles a secret split by EmbedShards from its stego files, given in any order
+	ExtractShards(req *models.ExtractRequest, stegoFiles [][]byte) (*models.ExtractResponse, *models.ShardSetReport, error)
+
+	// ExtractShares recovers a secret shared by EmbedShares from at least threshold of its stego files
+	ExtractShares(req *models.ExtractRequest, stegoFiles [][]byte) (*models.ExtractResponse, *models.ShareSetReport, error)
 }
 
 // CryptographyService defines the interface for cryptographic operations
 type CryptographyService interface {
-	// VigenereCipher performs Vigenère cipher encryption/decryption
+	// VigenereCipher performs extended (256-symbol) Vigenère cipher encryption/decryption
 	VigenereCipher(data []byte, key string, encrypt bool) []byte
+
+	// XORCipher performs legacy repeating-key XOR, used only to read stego files from older versions
+	XORCipher(data []byte, key string) []byte
+
+	// AESGCMEncrypt encrypts data with AES-256-GCM, prefixing the random nonce
+	AESGCMEncrypt(plaintext []byte, key []byte) ([]byte, error)
+
+	// AESGCMDecrypt decrypts and authenticates data produced by AESGCMEncrypt
+	AESGCMDecrypt(ciphertext []byte, key []byte) ([]byte, error)
+
+	// DeriveKeys derives encryption, position, integrity and header subkeys from a stego key with Argon2id
+	DeriveKeys(password string, salt []byte, params models.KDFParams) (*DerivedKeys, error)
+
+	// DeriveFileKeys derives the encryption and integrity subkeys of a secret encrypted to recipients from its file key
+	DeriveFileKeys(fileKey []byte) (*DerivedKeys, error)
+
+	// GenerateKeyPair creates an X25519 recipient key pair
+	GenerateKeyPair() (*models.KeyPair, error)
+
+	// ParseRecipients reads recipient public keys from text, one per line
+	ParseRecipients(data []byte) ([][]byte, error)
+
+	// ParseIdentities reads recipient private keys from an identity file, one per line
+	ParseIdentities(data []byte) ([][]byte, error)
+
+	// WrapFileKey encrypts a file key for the holder of an X25519 public key
+	WrapFileKey(fileKey []byte, publicKey []byte) ([]byte, error)
+
+	// UnwrapFileKey recovers a file key wrapped by WrapFileKey with the matching private key
+	UnwrapFileKey(stanza []byte, privateKey []byte) ([]byte, error)
+
+	// GenerateSigningKeyPair creates an Ed25519 signing key pair
+	GenerateSigningKeyPair() (*models.KeyPair, error)
+
+	// ParseSigningKey reads a single signing key from a key file or text
+	ParseSigningKey(data []byte) ([]byte, error)
+
+	// ParseSigners reads trusted signer public keys from text, one per line
+	ParseSigners(data []byte) ([][]byte, error)
+
+	// SignerPublicKey returns the public key of an Ed25519 signing key
+	SignerPublicKey(signingKey []byte) ([]byte, error)
+
+	// Sign signs data with an Ed25519 signing key
+	Sign(data []byte, signingKey []byte) ([]byte, error)
+
+	// Verify checks an Ed25519 signature made by Sign
+	Verify(data []byte, signature []byte, publicKey []byte) bool
 }
 
 // AudioService defines the interface for audio processing operations
 type AudioService interface {
 	// CalculatePSNR calculates Peak Signal-to-Noise Ratio between original and modified audio
 	CalculatePSNR(original, modified []byte) float64
+
+	// CalculateSNR calculates Signal-to-Noise Ratio between original and modified audio
+	CalculateSNR(original, modified []byte) float64
+
+	// DetectFormat detects the container format (MP3 or WAV) of the audio data from its signature
+	DetectFormat(audioData []byte) models.AudioFormat
+
+	// DecodeMP3 decodes MP3 data to interleaved 16-bit PCM and returns it with its sample rate and channel count
+	DecodeMP3(mp3Data []byte) (pcmData []byte, sampleRate int, channels int, err error)
 }
 
 // AudioEncoder defines the interface for audio encoding operations
 type AudioEncoder interface {
-	// EncodeToWAV encodes PCM data to WAV format
-	EncodeToWAV(pcmData []byte, sampleRate int) ([]byte, error)
+	// EncodeToWAV encodes interleaved 16-bit PCM data to WAV format
+	EncodeToWAV(pcmData []byte, sampleRate int, channels int) ([]byte, error)
 }
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+/*
+ Carrier layout when a stego key is used:
+
+ slots [0, 8*preambleSize)   key preamble, always sequential so it can be read before any key is known
+   hidden header (default):
+   - 16 bytes random salt, the KDF cost is not stored and must be supplied again if not the default
+   public header:
+   - 1 byte KDF id (1 = Argon2id)
+   - 1 byte time cost, 2 bytes memory cost in MiB (big endian), 1 byte threads
+   - 16 bytes random salt
+ remaining slots             container (header + payload), placed with the position subkey either
+                             as one run at a keyed start offset (random start) or bit by bit along a
+                             keyed permutation of the whole region (scatter); a deniable embedding
+                             splits them into two layers instead, see deniable.go
+
+ With a hidden header the whole container, magic included, is XORed with an AES-256-CTR keystream
+ under the header subkey, so without the key the carrier bits cannot be told apart from noise.
+
+ Stego files from older versions have no preamble; their container starts at slot 0 or at
+ deterministicStartIndex(stegoKey) and is still accepted on extraction.
+*/
+
+const (
+	kdfArgon2id        = 1
+	keySaltSize        = 16
+	keyPreambleSize    = 1 + 1 + 2 + 1 + keySaltSize
+	hiddenPreambleSize = keySaltSize
+	preambleParity     = 16   // Reed–Solomon parity bytes appended to the preamble when ECC is used
+	keystreamChunk     = 4096 // fewest keystream bytes generated at once
+)
+
+// bitLayout maps logical container bit i to a carrier slot. The container lives in the region
+// [regionStart, regionStart+regionSize) and begins at offset start inside it, wrapping around.
+// If perm is set the container bits are instead spread over the region in permutation order,
+// and if mask is set the container bytes are whitened with the keystream.
+type bitLayout struct {
+	regionStart int
+	regionSize  int
+	start       int
+	perm        *keyedPermutation
+	mask        *keystream
+}
+
+// slot returns the carrier slot holding container bit i
+func (l bitLayout) slot(i int) int {
+	if l.perm != nil {
+		return l.regionStart + l.perm.at(i)
+	}
+	return l.regionStart + (l.start+i)%l.regionSize
+}
+
+// writeBits stores bits in the carrier following the layout
+func (l bitLayout) writeBits(c bitCarrier, bits []uint8) {
+	for i, b := range bits {
+		c.setBit(l.slot(i), b)
+	}
+}
+
+// writeBytes whitens data if the layout has a mask and stores it in the carrier
+func (l bitLayout) writeBytes(c bitCarrier, data []byte) {
+	if l.mask != nil {
+		data = append([]byte(nil), data...)
+		l.mask.xor(0, data)
+	}
+	l.writeBits(c, bytesToBits(data))
+}
+
+// readBytes reads n container bytes starting at byte offset from the carrier bits.
+// Returns nil if the requested range does not fit in the region.
+func (l bitLayout) readBytes(bits bitReader, offset, n int) []byte {
+	if offset < 0 || n < 0 || (offset+n)*8 > l.regionSize {
+		return nil
+	}
+	out := make([]byte, n)
+	for i := 0; i < n*8; i++ {
+		if bits.bit(l.slot(offset*8+i)) == 1 {
+			out[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	if l.mask != nil {
+		l.mask.xor(offset, out)
+	}
+	return out
+}
+
+// byteSource reads container bytes by byte offset. readAt returns nil if the range is unavailable.
+type byteSource interface {
+	readAt(offset, n int) []byte
+}
+
+// layoutSource reads container bytes directly from the carrier bits through a layout
+type layoutSource struct {
+	bits   bitReader
+	layout bitLayout
+}
+
+func (s layoutSource) readAt(offset, n int) []byte {
+	return s.layout.readBytes(s.bits, offset, n)
+}
+
+// bytesSource reads container bytes from memory, e.g. a container rebuilt from Shamir shares
+type bytesSource []byte
+
+func (b bytesSource) readAt(offset, n int) []byte {
+	if offset < 0 || n < 0 || offset+n > len(b) {
+		return nil
+	}
+	return b[offset : offset+n]
+}
+
+// keystream is an AES-256-CTR keystream used to whiten hidden containers. The header subkey is
+// derived with a fresh salt for every embedding, so a zero IV never repeats under the same key.
+type keystream struct {
+	stream cipher.Stream
+	buf    []byte // keystream generated so far
+}
+
+// newKeystream creates the keystream for a 32-byte header subkey
+func newKeystream(key []byte) (*keystream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &keystream{stream: cipher.NewCTR(block, make([]byte, aes.BlockSize))}, nil
+}
+
+// xor whitens or unwhitens data located at byte offset of the container. The keystream is
+// generated in chunks of at least keystreamChunk bytes, doubling as it grows, so callers reading a
+// few bytes at a time (the QIM dither) do not run AES once per call.
+func (k *keystream) xor(offset int, data []byte) {
+	if need := offset + len(data); need > len(k.buf) {
+		ext := make([]byte, max(need, 2*len(k.buf), keystreamChunk)-len(k.buf))
+		k.stream.XORKeyStream(ext, ext)
+		k.buf = append(k.buf, ext...)
+	}
+	for i := range data {
+		data[i] ^= k.buf[offset+i]
+	}
+}
+
+// keyedStartIndex chooses the container start offset inside a region from the position subkey
+func keyedStartIndex(positionKey []byte, regionSize int) int {
+	if regionSize <= 0 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(positionKey[:8]) % uint64(regionSize))
+}
+
+// encodeKeyPreamble serialises the KDF parameters and salt written before the container
+func encodeKeyPreamble(params models.KDFParams, salt []byte) []byte {
+	out := make([]byte, 0, keyPreambleSize)
+	out = append(out, kdfArgon2id, params.Time)
+	out = binary.BigEndian.AppendUint16(out, params.MemoryMiB)
+	out = append(out, params.Threads)
+	return append(out, salt...)
+}
+
+// decodeKeyPreamble parses a key preamble. ok is false if the bytes cannot be a valid preamble,
+// which avoids running the KDF on covers that were embedded without a key.
+func decodeKeyPreamble(b []byte) (params models.KDFParams, salt []byte, ok bool) {
+	if len(b) < keyPreambleSize || b[0] != kdfArgon2id {
+		return models.KDFParams{}, nil, false
+	}
+	params = models.KDFParams{
+		Time:      b[1],
+		MemoryMiB: binary.BigEndian.Uint16(b[2:4]),
+		Threads:   b[4],
+	}
+	if !params.IsValid() {
+		return models.KDFParams{}, nil, false
+	}
+	return params, b[5:keyPreambleSize], true
+}
+
+// keyedPermutation is a Fisher–Yates shuffle of [0, n) driven by a ChaCha8 stream seeded with the
+// position subkey. Elements are generated lazily, so reading a short header only costs a few swaps
+// even when the cover offers millions of slots.
+type keyedPermutation struct {
+	n       int
+	rng     *rand.ChaCha8
+	swapped map[int]int // entries of the virtual array that differ from the identity
+	out     []int       // prefix of the permutation generated so far
+}
+
+// newKeyedPermutation creates the permutation of [0, n) selected by positionKey
+func newKeyedPermutation(positionKey []byte, n int) *keyedPermutation {
+	var seed [32]byte
+	copy(seed[:], positionKey)
+	return &keyedPermutation{n: n, rng: rand.NewChaCha8(seed), swapped: make(map[int]int)}
+}
+
+// at returns element i of the permutation, extending the shuffle as far as needed
+func (p *keyedPermutation) at(i int) int {
+	for len(p.out) <= i {
+		k := len(p.out)
+		j := k + p.uniform(p.n-k)
+		vj, ok := p.swapped[j]
+		if !ok {
+			vj = j
+		}
+		vk, ok := p.swapped[k]
+		if !ok {
+			vk = k
+		}
+		// a[k] is never read again, only a[j] has to remember the swap
+		p.swapped[j] = vk
+		delete(p.swapped, k)
+		p.out = append(p.out, vj)
+	}
+	return p.out[i]
+}
+
+// uniform returns an unbiased value in [0, n) using rejection sampling on the ChaCha8 stream
+func (p *keyedPermutation) uniform(n int) int {
+	limit := math.MaxUint64 - math.MaxUint64%uint64(n)
+	for {
+		if v := p.rng.Uint64(); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// A public preamble is read before anything is authenticated, so a cost embed cannot produce must
+// not reach Argon2id
+func TestDecodeKeyPreambleRejectsCostlyKDF(t *testing.T) {
+	salt := make([]byte, keySaltSize)
+	if _, _, ok := decodeKeyPreamble(encodeKeyPreamble(models.DefaultKDFParams(), salt)); !ok {
+		t.Fatal("default cost rejected")
+	}
+	for _, params := range []models.KDFParams{
+		{Time: 10, MemoryMiB: 64, Threads: 4},
+		{Time: 3, MemoryMiB: 1024, Threads: 4},
+	} {
+		if _, _, ok := decodeKeyPreamble(encodeKeyPreamble(params, salt)); ok {
+			t.Fatalf("cost %+v accepted", params)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"encoding/binary"
+)
+
+/*
+ Layer III side information (ISO/IEC 11172-3, ISO/IEC 13818-3):
+
+ MPEG1 (2 granules):  main_data_begin(9) private_bits(5 mono / 3 stereo) scfsi(4 per channel)
+                      then per granule, per channel a 59-bit block
+ MPEG2/2.5 (1 granule): main_data_begin(8) private_bits(1 mono / 2 stereo)
+                      then per channel a 63-bit block
+
+ Each block starts with part2_3_length(12) big_values(9) global_gain(8). Because the blocks
+ have a fixed size, global_gain can be located without decoding the Huffman-coded main data.
+*/
+
+// mp3FrameInfo describes the header fields needed to locate the side information of a frame
+type mp3FrameInfo struct {
+	offset   int  // offset of the frame header in the file
+	size     int  // frame size in bytes including the header
+	layer3   bool // Layer III frame (side information present)
+	mpeg1    bool // MPEG1 (2 granules) vs MPEG2/2.5 (1 granule)
+	channels int  // 1 for single channel mode, 2 otherwise
+	hasCRC   bool // protection_bit == 0, a 16-bit CRC follows the header
+}
+
+// parseMP3FrameInfo parses the frame header at pos. ok is false if there is no valid frame.
+func parseMP3FrameInfo(data []byte, pos int) (info mp3FrameInfo, ok bool) {
+	size := parseMP3FrameSize(data, pos)
+	if size <= 4 {
+		return mp3FrameInfo{}, false
+	}
+	info = mp3FrameInfo{
+		offset:   pos,
+		size:     size,
+		layer3:   (data[pos+1]>>1)&0x03 == 0x01,
+		mpeg1:    (data[pos+1]>>3)&0x03 == 0x03,
+		channels: 2,
+		hasCRC:   data[pos+1]&0x01 == 0,
+	}
+	if (data[pos+3]>>6)&0x03 == 0x03 {
+		info.channels = 1
+	}
+	return info, true
+}
+
+// sideInfoOffset returns the file offset of the first side information byte
+func (f mp3FrameInfo) sideInfoOffset() int {
+	if f.hasCRC {
+		return f.offset + 6
+	}
+	return f.offset + 4
+}
+
+// sideInfoSize returns the side information size in bytes (0 for non Layer III frames)
+func (f mp3FrameInfo) sideInfoSize() int {
+	if !f.layer3 {
+		return 0
+	}
+	switch {
+	case f.mpeg1 && f.channels == 1:
+		return 17
+	case f.mpeg1:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// globalGainLSBPositions returns the absolute bit positions (MSB-first) of the least
+// significant bit of global_gain for every granule and channel of a Layer III frame
+func (f mp3FrameInfo) globalGainLSBPositions() []int {
+	if !f.layer3 || f.sideInfoOffset()+f.sideInfoSize() > f.offset+f.size {
+		return nil
+	}
+	base := f.sideInfoOffset() * 8
+	const gainLSB = 12 + 9 + 7 // part2_3_length + big_values + 7 bits into global_gain
+
+	var positions []int
+	if f.mpeg1 {
+		privateBits := 3
+		if f.channels == 1 {
+			privateBits = 5
+		}
+		head := 9 + privateBits + 4*f.channels
+		for gr := 0; gr < 2; gr++ {
+			for ch := 0; ch < f.channels; ch++ {
+				positions = append(positions, base+head+(gr*f.channels+ch)*59+gainLSB)
+			}
+		}
+	} else {
+		privateBits := 2
+		if f.channels == 1 {
+			privateBits = 1
+		}
+		head := 8 + privateBits
+		for ch := 0; ch < f.channels; ch++ {
+			positions = append(positions, base+head+ch*63+gainLSB)
+		}
+	}
+	return positions
+}
+
+// collectMP3Frames walks the MP3 stream between the leading ID3v2 tag and any trailing tags
+// (ID3v1, APEv2, Lyrics3, appended ID3v2) and returns every valid frame. Tag bytes are never
+// scanned for sync words, so metadata cannot be mistaken for frames and modified.
+func collectMP3Frames(data []byte) []mp3FrameInfo {
+	var frames []mp3FrameInfo
+	end := findAudioEnd(data)
+	i := parseID3v2Size(data)
+	for i < end-4 {
+		if !isFrameSyncAt(data, i) {
+			i++
+			continue
+		}
+		info, ok := parseMP3FrameInfo(data, i)
+		if !ok || info.offset+info.size > end {
+			i++
+			continue
+		}
+		frames = append(frames, info)
+		i += info.size
+	}
+	return frames
+}
+
+// isVBRTagFrame reports whether the frame carries a Xing/Info (LAME) or VBRI tag instead of audio.
+// Xing/Info tags start right after the side information, VBRI tags 32 bytes after the header.
+func isVBRTagFrame(data []byte, f mp3FrameInfo) bool {
+	end := f.offset + f.size
+	xing := f.sideInfoOffset() + f.sideInfoSize()
+	if f.layer3 && xing+4 <= end {
+		tag := string(data[xing : xing+4])
+		if tag == "Xing" || tag == "Info" {
+			return true
+		}
+	}
+	vbri := f.offset + 4 + 32
+	return vbri+4 <= end && string(data[vbri:vbri+4]) == "VBRI"
+}
+
+// collectGlobalGainBits returns the bit positions of all global_gain LSBs in the stream.
+// Changing one of these bits alters the gain of a single granule by about 1.5 dB but keeps
+// part2_3_length, the Huffman data and the frame layout intact, so the stream stays decodable.
+// VBR tag frames are left untouched.
+func collectGlobalGainBits(data []byte) []int {
+	var positions []int
+	for _, f := range collectMP3Frames(data) {
+		if isVBRTagFrame(data, f) {
+			continue
+		}
+		positions = append(positions, f.globalGainLSBPositions()...)
+	}
+	return positions
+}
+
+// mp3FrameCRC computes the CRC-16 (polynomial 0x8005, initial value 0xFFFF) that protects
+// header bytes 2-3 and the side information of a frame
+func mp3FrameCRC(data []byte, f mp3FrameInfo) uint16 {
+	crc := uint16(0xFFFF)
+	feed := func(b byte) {
+		for i := 7; i >= 0; i-- {
+			top := (crc >> 15) & 1
+			crc <<= 1
+			if top^uint16((b>>uint(i))&1) == 1 {
+				crc ^= 0x8005
+			}
+		}
+	}
+	feed(data[f.offset+2])
+	feed(data[f.offset+3])
+	start := f.sideInfoOffset()
+	for _, b := range data[start : start+f.sideInfoSize()] {
+		feed(b)
+	}
+	return crc
+}
+
+// updateFrameCRCs recomputes the CRC of every protected Layer III frame after its side
+// information has been modified
+func updateFrameCRCs(data []byte) {
+	for _, f := range collectMP3Frames(data) {
+		if !f.hasCRC || !f.layer3 || f.sideInfoOffset()+f.sideInfoSize() > f.offset+f.size {
+			continue
+		}
+		binary.BigEndian.PutUint16(data[f.offset+4:f.offset+6], mp3FrameCRC(data, f))
+	}
+}
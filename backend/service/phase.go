@@ -0,0 +1,181 @@
+package service
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+/*
+ Phase coding: the audio is cut into segments of phaseSegment samples per channel. The message sits
+ in the phase spectrum of the first segment, bin phaseBandStart+k carrying slot k in the upper half
+ plane for a 0 and the lower half plane for a 1. The band (about 340 Hz to 3.1 kHz at 44.1 kHz)
+ leaves the bass, where the ear follows phase best, and the quiet highs, whose phase noise would
+ decide the bit, alone. A bin is only rotated as far as it takes to lie phaseMargin inside its half
+ plane, by the same angle in every channel so the stereo image keeps its phase differences.
+
+ Segments are rewritten with raised-cosine fades of phaseRamp samples at both edges, so neighbouring
+ segments join without a click; bins of the first segment the fades push across the real axis are
+ rotated further until they read back. Every following segment then has each band bin rotated by
+ the change its bin in the first segment ended up with, so the phase differences between
+ consecutive segments, which the ear notices, stay those of the cover. Reading only needs the
+ first segment of the stego file, not the cover.
+
+ Silence has no phase to code, so the first segment is the first one that is louder than
+ phaseMinRMS; the silent segments before it are left alone. Rotating phases keeps the energy of
+ the segment, so the reader finds the same one.
+*/
+
+const (
+	phaseSegment   = 65536       // samples per channel in a segment, a power of two for the FFT
+	phaseBandStart = 512         // first bin carrying a bit, about 340 Hz at 44.1 kHz
+	phaseBandSize  = 4096        // bins carrying a bit, up to about 3.1 kHz
+	phaseRamp      = 512         // samples over which the change fades in and out at the segment edges
+	phaseMinRMS    = 100         // RMS of the channel mix a segment needs to carry the message
+	phaseMargin    = math.Pi / 4 // least angle between a written phase and the real axis
+	phasePasses    = 4           // most rounds of rotating the bins that read back wrong further
+)
+
+// phaseCarrier stores one bit per band bin of the first segment. Bits only update the rotation of
+// their bin; the segments are rewritten from the cover samples once all bits are set.
+type phaseCarrier struct {
+	signal    *pcmSignal
+	first     int       // first frame of the segment carrying the message
+	phases    []float64 // phase of every slot's bin in the channel mix of the first segment
+	base      []float64 // phase of every slot's bin in the channel mix, as in the cover
+	rotations []float64 // angle every slot's bin is rotated by in all channels
+	dirty     bool
+}
+
+// newPhaseCarrier reads the phase spectrum of the first segment of signal that is not silent
+func newPhaseCarrier(signal *pcmSignal) *phaseCarrier {
+	c := &phaseCarrier{signal: signal}
+	for c.first = 0; c.first+phaseSegment <= signal.frames; c.first += phaseSegment {
+		mix := signal.mix(c.first, phaseSegment)
+		var energy float64
+		for _, v := range mix {
+			energy += v * v
+		}
+		if math.Sqrt(energy/phaseSegment) < phaseMinRMS {
+			continue
+		}
+		c.phases = phaseSpectrum(mix)[phaseBandStart : phaseBandStart+phaseBandSize]
+		c.base = append([]float64(nil), c.phases...)
+		c.rotations = make([]float64, phaseBandSize)
+		break
+	}
+	return c
+}
+
+func (c *phaseCarrier) capacity() int {
+	return len(c.phases)
+}
+
+func (c *phaseCarrier) bit(slot int) uint8 {
+	if c.phases[slot] < 0 {
+		return 1
+	}
+	return 0
+}
+
+// setBit moves the phase of the bin of slot to the nearest phase at least phaseMargin into the half
+// plane of bit, above the real axis for a 0 and below it for a 1
+func (c *phaseCarrier) setBit(slot int, bit uint8) {
+	// the half plane of a 0, or of a 1 mirrored onto it
+	base := c.base[slot]
+	if bit == 1 {
+		base = -base
+	}
+	phase := math.Max(phaseMargin, math.Min(math.Pi-phaseMargin, base))
+	if base < -math.Pi/2 {
+		phase = math.Pi - phaseMargin
+	}
+	if bit == 1 {
+		phase = -phase
+	}
+	c.phases[slot] = phase
+	c.rotations[slot] = phase - c.base[slot]
+	c.dirty = true
+}
+
+// flush rewrites the first segment from the cover samples with the band rotations applied. The
+// fades blur the phases a little, so bins that read back in the wrong half plane are rotated
+// further, for up to phasePasses rounds. The following segments are then rotated by the change the
+// first segment ended up with.
+func (c *phaseCarrier) flush() {
+	if !c.dirty {
+		return
+	}
+	var phases []float64
+	for pass := 0; pass < phasePasses; pass++ {
+		c.write(c.first, c.rotations)
+		phases = phaseSpectrum(c.signal.mix(c.first, phaseSegment))[phaseBandStart : phaseBandStart+phaseBandSize]
+		settled := true
+		for j, phase := range phases {
+			if math.Signbit(phase) != math.Signbit(c.phases[j]) {
+				c.rotations[j] += math.Remainder(c.phases[j]-phase, 2*math.Pi)
+				settled = false
+			}
+		}
+		if settled {
+			break
+		}
+	}
+	carried := make([]float64, phaseBandSize)
+	for j, phase := range phases {
+		carried[j] = phase - c.base[j]
+	}
+	for start := c.first + phaseSegment; start+phaseSegment <= c.signal.frames; start += phaseSegment {
+		c.write(start, carried)
+	}
+	c.dirty = false
+}
+
+// write rewrites the segment from start from the cover samples with every band bin rotated by its
+// angle, fading the change in and out over phaseRamp samples at both edges
+func (c *phaseCarrier) write(start int, rotations []float64) {
+	spectrum := make([]complex128, phaseSegment)
+	for ch := 0; ch < c.signal.channels; ch++ {
+		original := c.originalSegment(start, ch)
+		for i, v := range original {
+			spectrum[i] = complex(v, 0)
+		}
+		fft(spectrum, false)
+		// rotate the mirrored bin the other way so the signal stays real
+		for j, angle := range rotations {
+			k := phaseBandStart + j
+			spectrum[k] *= cmplx.Rect(1, angle)
+			spectrum[phaseSegment-k] *= cmplx.Rect(1, -angle)
+		}
+		fft(spectrum, true)
+		for i, v := range original {
+			weight := 1.0
+			if edge := min(i, phaseSegment-1-i); edge < phaseRamp {
+				weight = 0.5 - 0.5*math.Cos(math.Pi*float64(edge)/phaseRamp)
+			}
+			c.signal.setSample(start+i, ch, v+weight*(real(spectrum[i])-v))
+		}
+	}
+}
+
+// originalSegment returns the cover samples of one channel for the segment starting at start
+func (c *phaseCarrier) originalSegment(start, ch int) []float64 {
+	out := make([]float64, phaseSegment)
+	for i := range out {
+		out[i] = c.signal.originalSample(start+i, ch)
+	}
+	return out
+}
+
+// phaseSpectrum returns the phase of every bin of the spectrum of samples
+func phaseSpectrum(samples []float64) []float64 {
+	spectrum := make([]complex128, len(samples))
+	for i, v := range samples {
+		spectrum[i] = complex(v, 0)
+	}
+	fft(spectrum, false)
+	phases := make([]float64, len(spectrum))
+	for i, v := range spectrum {
+		phases[i] = cmplx.Phase(v)
+	}
+	return phases
+}
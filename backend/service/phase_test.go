@@ -0,0 +1,68 @@
+package service
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// The following segments are rotated along with the first, so the band phases of consecutive
+// segments differ by what they differed in the cover. Weak bins barely matter to the ear and take
+// the blur of the fades most, so the change is weighted by magnitude.
+func TestPhaseKeepsSegmentDifferences(t *testing.T) {
+	cover := testWAV(4*phaseSegment, 1)
+	req := models.EmbedRequest{CoverAudio: cover, Method: models.MethodPhase, ECC: models.ECCHigh}
+	stego, _, err := newTestStegoService().EmbedMessage(&req, []byte("rotated along"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := newPCMSignal(cover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := newPCMSignal(stego)
+	if err != nil {
+		t.Fatal(err)
+	}
+	band := func(signal *pcmSignal, segment int) []complex128 {
+		spectrum := make([]complex128, phaseSegment)
+		for i, v := range signal.mix(segment*phaseSegment, phaseSegment) {
+			spectrum[i] = complex(v, 0)
+		}
+		fft(spectrum, false)
+		return spectrum[phaseBandStart : phaseBandStart+phaseBandSize]
+	}
+	for segment := 1; segment < 4; segment++ {
+		prevBefore, curBefore := band(before, segment-1), band(before, segment)
+		prevAfter, curAfter := band(after, segment-1), band(after, segment)
+		var change, weight float64
+		for j := range curBefore {
+			difference := cmplx.Phase(curAfter[j]/prevAfter[j]) - cmplx.Phase(curBefore[j]/prevBefore[j])
+			change += cmplx.Abs(curBefore[j]) * math.Abs(math.Remainder(difference, 2*math.Pi))
+			weight += cmplx.Abs(curBefore[j])
+		}
+		if change /= weight; change > 0.2 {
+			t.Fatalf("segment %d: phase differences changed by %.3f rad", segment, change)
+		}
+	}
+}
+
+// A cover too quiet for any segment to carry the message has no phase capacity
+func TestPhaseCapacitySkipsSilence(t *testing.T) {
+	quiet := testWAV(2*phaseSegment, 1)
+	samples := pcmRegion(quiet)
+	for i := 0; i < len(samples); i += 2 {
+		v := int16(uint16(samples[i]) | uint16(samples[i+1])<<8)
+		v /= 200
+		samples[i], samples[i+1] = byte(v), byte(uint16(v)>>8)
+	}
+	capacity, err := newTestStegoService().CalculateCapacity(quiet, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capacity.Phase != 0 {
+		t.Fatalf("phase capacity %d bytes", capacity.Phase)
+	}
+}
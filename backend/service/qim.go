@@ -0,0 +1,92 @@
+package service
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+/*
+ Quantization index modulation (dither modulation): every sample of every channel carries one bit.
+ A 0 moves the sample to the nearest point of the lattice step·k + dither, a 1 to the nearest point
+ of the lattice shifted by half a step. The dither of every sample comes from an AES-CTR keystream
+ keyed with the stego key, so without the key the lattices cannot be told apart. A bit is read back
+ by minimum-distance decoding: whichever lattice has a point closer to the sample wins, so a sample
+ may change by up to a quarter step before its bit flips. A larger step survives more noise and
+ requantization at the cost of more distortion (at most half a step per sample).
+
+ Steps and dithers are whole numbers and steps are even, so every lattice point is a valid sample.
+ The step is stored as its base-2 logarithm in the nLSB byte of the header; extraction tries every
+ step.
+*/
+
+// qimStep returns the quantization step of the request
+func qimStep(req *models.EmbedRequest) int {
+	if req.QIMStep != 0 {
+		return req.QIMStep
+	}
+	return models.DefaultQIMStep
+}
+
+// qimCarrier stores one bit per sample by quantizing it onto one of two dithered lattices
+type qimCarrier struct {
+	signal *pcmSignal
+	step   int
+	stream *keystream // two bytes per interleaved sample, generated as far as slots are used
+}
+
+// newQIMCarrier derives the dither of every sample of signal from stegoKey; without a key every file
+// uses the same public dither
+func newQIMCarrier(signal *pcmSignal, stepExp int, stegoKey string) (*qimCarrier, error) {
+	key, err := hkdf.Key(sha256.New, []byte(stegoKey), nil, "astego qim dither", 32)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := newKeystream(key)
+	if err != nil {
+		return nil, err
+	}
+	return &qimCarrier{signal: signal, step: 1 << stepExp, stream: stream}, nil
+}
+
+func (c *qimCarrier) capacity() int {
+	return len(c.signal.original)
+}
+
+// dither returns the offset of the lattices of slot, in [0, step)
+func (c *qimCarrier) dither(slot int) int {
+	var random [2]byte
+	c.stream.xor(2*slot, random[:])
+	return int(binary.BigEndian.Uint16(random[:])) % c.step
+}
+
+func (c *qimCarrier) bit(slot int) uint8 {
+	frame, ch := slot/c.signal.channels, slot%c.signal.channels
+	// offset of the sample above the nearest lower point of the lattice of a 0
+	r := math.Mod(c.signal.sample(frame, ch)-float64(c.dither(slot)), float64(c.step))
+	if r < 0 {
+		r += float64(c.step)
+	}
+	half := float64(c.step) / 2
+	if math.Abs(r-half) < math.Min(r, float64(c.step)-r) {
+		return 1
+	}
+	return 0
+}
+
+func (c *qimCarrier) setBit(slot int, bit uint8) {
+	frame, ch := slot/c.signal.channels, slot%c.signal.channels
+	offset := float64(c.dither(slot) + int(bit)*c.step/2)
+	step := float64(c.step)
+	q := math.Round((c.signal.originalSample(frame, ch)-offset)/step)*step + offset
+	// stay on the lattice when the nearest point lies outside the 16-bit range
+	if q > math.MaxInt16 {
+		q -= step
+	} else if q < math.MinInt16 {
+		q += step
+	}
+	c.signal.setSample(frame, ch, q)
+}
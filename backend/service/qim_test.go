@@ -0,0 +1,22 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// The step is not named at extraction; it is found among the accepted steps and reported
+func TestQIMStep(t *testing.T) {
+	req := models.EmbedRequest{CoverAudio: testWAV(20000, 2), Method: models.MethodQIM, QIMStep: 128,
+		StegoKey: "qim key", KDF: testKDF, ECC: models.ECCHigh, UseScatter: true}
+	s := newTestStegoService()
+	stego, _, err := s.EmbedMessage(&req, []byte("quantized onto one of two dithered lattices"), nil)
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	result, err := s.ExtractContainer(&models.ExtractRequest{StegoKey: "qim key", KDF: testKDF}, stego)
+	if err != nil || result.QIMStep != 128 {
+		t.Fatalf("step %d, %v", result.QIMStep, err)
+	}
+}
@@ -0,0 +1,327 @@
+package service
+
+import (
+	"errors"
+)
+
+/*
+ Reed–Solomon coding over GF(2^8) (primitive polynomial 0x11d, generator 2, first consecutive root 1).
+ A codeword is at most 255 bytes: the data bytes followed by nsym parity bytes, and up to nsym/2
+ corrupted bytes anywhere in the codeword are corrected. Polynomials are stored highest degree first.
+*/
+
+const rsBlockSize = 255
+
+var errTooManyErrors = errors.New("reed-solomon: too many errors to correct")
+
+var gfExp, gfLog = buildGFTables()
+
+// buildGFTables builds the exponent and logarithm tables of GF(2^8).
+// The exponent table is doubled so products of two logarithms never need a modulo.
+func buildGFTables() (exp [512]byte, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(gfLog[a]+255-gfLog[b])%255]
+}
+
+// gfPow2 returns 2^power, power may be negative
+func gfPow2(power int) byte {
+	return gfExp[((power%255)+255)%255]
+}
+
+func gfInverse(x byte) byte {
+	return gfExp[255-gfLog[x]]
+}
+
+func gfPolyScale(p []byte, x byte) []byte {
+	r := make([]byte, len(p))
+	for i, c := range p {
+		r[i] = gfMul(c, x)
+	}
+	return r
+}
+
+func gfPolyAdd(p, q []byte) []byte {
+	n := len(p)
+	if len(q) > n {
+		n = len(q)
+	}
+	r := make([]byte, n)
+	for i, c := range p {
+		r[i+n-len(p)] = c
+	}
+	for i, c := range q {
+		r[i+n-len(q)] ^= c
+	}
+	return r
+}
+
+func gfPolyMul(p, q []byte) []byte {
+	r := make([]byte, len(p)+len(q)-1)
+	for j, qc := range q {
+		for i, pc := range p {
+			r[i+j] ^= gfMul(pc, qc)
+		}
+	}
+	return r
+}
+
+// gfPolyEval evaluates p at x with Horner's scheme
+func gfPolyEval(p []byte, x byte) byte {
+	y := p[0]
+	for _, c := range p[1:] {
+		y = gfMul(y, x) ^ c
+	}
+	return y
+}
+
+// rsGeneratorPoly returns the generator polynomial (x - 2^0)(x - 2^1)...(x - 2^(nsym-1))
+func rsGeneratorPoly(nsym int) []byte {
+	g := []byte{1}
+	for i := 0; i < nsym; i++ {
+		g = gfPolyMul(g, []byte{1, gfPow2(i)})
+	}
+	return g
+}
+
+// rsEncode returns data followed by nsym parity bytes. len(data)+nsym must not exceed 255.
+func rsEncode(data []byte, nsym int) []byte {
+	gen := rsGeneratorPoly(nsym)
+	out := make([]byte, len(data)+nsym)
+	copy(out, data)
+	for i := range data {
+		coef := out[i]
+		if coef == 0 {
+			continue
+		}
+		for j := 1; j < len(gen); j++ {
+			out[i+j] ^= gfMul(gen[j], coef)
+		}
+	}
+	copy(out, data)
+	return out
+}
+
+// rsDecode corrects up to nsym/2 byte errors in codeword and returns the data bytes
+func rsDecode(codeword []byte, nsym int) ([]byte, error) {
+	if len(codeword) <= nsym || len(codeword) > rsBlockSize {
+		return nil, errTooManyErrors
+	}
+	msg := append([]byte(nil), codeword...)
+	synd := rsSyndromes(msg, nsym)
+	if isZeroPoly(synd) {
+		return msg[:len(msg)-nsym], nil
+	}
+
+	errLoc, err := rsErrorLocator(synd, nsym)
+	if err != nil {
+		return nil, err
+	}
+	errPos, err := rsFindErrors(reversed(errLoc), len(msg))
+	if err != nil {
+		return nil, err
+	}
+	msg = rsCorrectErrata(msg, synd, errPos)
+
+	// the correction must yield a valid codeword, otherwise there were more errors than nsym/2
+	if !isZeroPoly(rsSyndromes(msg, nsym)) {
+		return nil, errTooManyErrors
+	}
+	return msg[:len(msg)-nsym], nil
+}
+
+// rsSyndromes evaluates the codeword at the generator roots. The result is padded with a leading
+// zero so that syndrome i sits at index i+1, as expected by the locator and evaluator below.
+func rsSyndromes(msg []byte, nsym int) []byte {
+	synd := make([]byte, nsym+1)
+	for i := 0; i < nsym; i++ {
+		synd[i+1] = gfPolyEval(msg, gfPow2(i))
+	}
+	return synd
+}
+
+// rsErrorLocator computes the error locator polynomial with the Berlekamp–Massey algorithm
+func rsErrorLocator(synd []byte, nsym int) ([]byte, error) {
+	errLoc := []byte{1}
+	oldLoc := []byte{1}
+	shift := len(synd) - nsym
+	for i := 0; i < nsym; i++ {
+		k := i + shift
+		delta := synd[k]
+		for j := 1; j < len(errLoc); j++ {
+			delta ^= gfMul(errLoc[len(errLoc)-1-j], synd[k-j])
+		}
+		oldLoc = append(oldLoc, 0)
+		if delta != 0 {
+			if len(oldLoc) > len(errLoc) {
+				newLoc := gfPolyScale(oldLoc, delta)
+				oldLoc = gfPolyScale(errLoc, gfInverse(delta))
+				errLoc = newLoc
+			}
+			errLoc = gfPolyAdd(errLoc, gfPolyScale(oldLoc, delta))
+		}
+	}
+	for len(errLoc) > 0 && errLoc[0] == 0 {
+		errLoc = errLoc[1:]
+	}
+	if (len(errLoc)-1)*2 > nsym {
+		return nil, errTooManyErrors
+	}
+	return errLoc, nil
+}
+
+// rsFindErrors finds the roots of the (reversed) error locator by brute force (Chien search)
+func rsFindErrors(errLoc []byte, n int) ([]int, error) {
+	var pos []int
+	for i := 0; i < n; i++ {
+		if gfPolyEval(errLoc, gfPow2(i)) == 0 {
+			pos = append(pos, n-1-i)
+		}
+	}
+	if len(pos) != len(errLoc)-1 {
+		return nil, errTooManyErrors
+	}
+	return pos, nil
+}
+
+// rsCorrectErrata computes the error magnitudes with the Forney algorithm and applies them
+func rsCorrectErrata(msg []byte, synd []byte, errPos []int) []byte {
+	coefPos := make([]int, len(errPos))
+	for i, p := range errPos {
+		coefPos[i] = len(msg) - 1 - p
+	}
+
+	// errata locator and evaluator polynomials
+	errLoc := []byte{1}
+	for _, p := range coefPos {
+		errLoc = gfPolyMul(errLoc, gfPolyAdd([]byte{1}, []byte{gfPow2(p), 0}))
+	}
+	product := gfPolyMul(reversed(synd), errLoc)
+	errEval := reversed(product[len(product)-len(errLoc):])
+
+	x := make([]byte, len(coefPos))
+	for i, p := range coefPos {
+		x[i] = gfPow2(-(rsBlockSize - p))
+	}
+
+	e := make([]byte, len(msg))
+	for i, xi := range x {
+		xiInv := gfInverse(xi)
+		locPrime := byte(1)
+		for j, xj := range x {
+			if j != i {
+				locPrime = gfMul(locPrime, 1^gfMul(xiInv, xj))
+			}
+		}
+		y := gfMul(xi, gfPolyEval(reversed(errEval), xiInv))
+		if locPrime == 0 {
+			continue // degenerate locator, the final syndrome check rejects the result
+		}
+		e[errPos[i]] = gfDiv(y, locPrime)
+	}
+	return gfPolyAdd(msg, e)
+}
+
+func isZeroPoly(p []byte) bool {
+	for _, c := range p {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func reversed(p []byte) []byte {
+	r := make([]byte, len(p))
+	for i, c := range p {
+		r[len(p)-1-i] = c
+	}
+	return r
+}
+
+// eccEncode splits data into blocks of 255-nsym bytes, zero padding the last one, and appends nsym
+// parity bytes to every block. The result is always a multiple of 255 bytes long.
+func eccEncode(data []byte, nsym int) []byte {
+	k := rsBlockSize - nsym
+	out := make([]byte, 0, (len(data)+k-1)/k*rsBlockSize)
+	for start := 0; start < len(data); start += k {
+		block := make([]byte, k)
+		copy(block, data[start:min(start+k, len(data))])
+		out = append(out, rsEncode(block, nsym)...)
+	}
+	return out
+}
+
+// eccCapacity returns how many data bytes fit in capacity bytes once Reed–Solomon parity is added
+func eccCapacity(capacity, nsym int) int {
+	if nsym == 0 {
+		return capacity
+	}
+	return capacity / rsBlockSize * (rsBlockSize - nsym)
+}
+
+// eccSource reads the data bytes of an ECC-coded container, decoding blocks as they are needed
+type eccSource struct {
+	src    byteSource
+	nsym   int
+	blocks map[int][]byte // decoded blocks, nil if the block could not be corrected
+}
+
+func newECCSource(src byteSource, nsym int) *eccSource {
+	return &eccSource{src: src, nsym: nsym, blocks: make(map[int][]byte)}
+}
+
+func (e *eccSource) readAt(offset, n int) []byte {
+	if offset < 0 || n < 0 {
+		return nil
+	}
+	k := rsBlockSize - e.nsym
+	out := make([]byte, 0, n)
+	for pos := offset; pos < offset+n; {
+		block := e.block(pos / k)
+		if block == nil {
+			return nil
+		}
+		chunk := block[pos%k : min(k, pos%k+offset+n-pos)]
+		out = append(out, chunk...)
+		pos += len(chunk)
+	}
+	return out
+}
+
+// block returns decoded block i, or nil if it is out of range or has too many errors
+func (e *eccSource) block(i int) []byte {
+	if block, ok := e.blocks[i]; ok {
+		return block
+	}
+	var block []byte
+	if coded := e.src.readAt(i*rsBlockSize, rsBlockSize); coded != nil {
+		block, _ = rsDecode(coded, e.nsym)
+	}
+	e.blocks[i] = block
+	return block
+}
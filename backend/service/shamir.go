@@ -0,0 +1,83 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+/*
+ Shamir secret sharing over GF(2^8), using the field of reed_solomon.go. Every secret byte is the
+ constant term of its own random polynomial of degree threshold-1; share x (1..255) holds the
+ values of all polynomials at x. Any threshold shares recover the secret by Lagrange
+ interpolation at 0, fewer reveal nothing about it beyond its length.
+*/
+
+var errInvalidShares = errors.New("shamir: shares are inconsistent")
+
+// shamirSplit splits secret into count shares, any threshold of which recover it.
+// Share i is evaluated at x = i+1.
+func shamirSplit(secret []byte, threshold, count int) ([][]byte, error) {
+	if threshold < 2 || threshold > count || count > 255 {
+		return nil, errInvalidShares
+	}
+
+	// coefficients of degree 1..threshold-1 for every secret byte
+	coeffs := make([][]byte, threshold-1)
+	for d := range coeffs {
+		coeffs[d] = make([]byte, len(secret))
+		if _, err := rand.Read(coeffs[d]); err != nil {
+			return nil, err
+		}
+	}
+
+	shares := make([][]byte, count)
+	for i := range shares {
+		x := byte(i + 1)
+		share := make([]byte, len(secret))
+		for j := range secret {
+			// Horner's scheme from the highest degree down to the secret byte
+			y := byte(0)
+			for d := len(coeffs) - 1; d >= 0; d-- {
+				y = gfMul(y, x) ^ coeffs[d][j]
+			}
+			share[j] = gfMul(y, x) ^ secret[j]
+		}
+		shares[i] = share
+	}
+	return shares, nil
+}
+
+// shamirCombine recovers the secret from shares taken at the distinct non-zero points xs.
+// Exactly threshold shares are needed; more are allowed but not checked against each other.
+func shamirCombine(xs []byte, shares [][]byte) ([]byte, error) {
+	if len(xs) == 0 || len(xs) != len(shares) {
+		return nil, errInvalidShares
+	}
+
+	// Lagrange basis at 0: w_j = prod over m != j of x_m / (x_m - x_j), subtraction is XOR
+	weights := make([]byte, len(xs))
+	for j, xj := range xs {
+		if xj == 0 || len(shares[j]) != len(shares[0]) {
+			return nil, errInvalidShares
+		}
+		w := byte(1)
+		for m, xm := range xs {
+			if m == j {
+				continue
+			}
+			if xm == xj {
+				return nil, errInvalidShares
+			}
+			w = gfMul(w, gfDiv(xm, xm^xj))
+		}
+		weights[j] = w
+	}
+
+	secret := make([]byte, len(shares[0]))
+	for j, share := range shares {
+		for i, y := range share {
+			secret[i] ^= gfMul(weights[j], y)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+/*
+ Shard sets: a secret too large for one cover is compressed once and the compressed stream is split
+ across several covers. Every shard is a complete container with its own key preamble, encryption,
+ integrity tag and ECC; its shard TLV records the set id, its sequence number and the shard count,
+ and the remaining TLVs (original size, codec, directory...) describe the reassembled secret.
+*/
+
+// EmbedShards splits secretData across covers and returns one stego file per cover, in cover order,
+// with the PSNR and SNR of each. Every cover receives a part proportional to its capacity.
+func (s *stegoService) EmbedShards(req *models.EmbedRequest, covers [][]byte, secretData []byte, metadata []byte) ([][]byte, []models.Distortion, error) {
+	if len(covers) < 2 || len(covers) > 0xFFFF {
+		return nil, nil, models.ErrInvalidShardCount
+	}
+	if err := validateEmbedRequest(req); err != nil {
+		return nil, nil, err
+	}
+	header, payload, err := prepareSecret(req, secretData, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	setID, err := newSetID()
+	if err != nil {
+		return nil, nil, err
+	}
+	header.shard = &shardInfo{setID: setID, count: len(covers)}
+
+	decoded, err := s.decodeCovers(req, covers)
+	if err != nil {
+		return nil, nil, err
+	}
+	capacities := make([]int, len(covers))
+	total := 0
+	for i, cover := range decoded {
+		if capacities[i], err = s.payloadCapacity(req, cover, header); err != nil {
+			return nil, nil, err
+		}
+		total += capacities[i]
+	}
+	if total < len(payload) {
+		return nil, nil, models.ErrInsufficientCapacity
+	}
+
+	parts := splitProportionally(len(payload), capacities)
+	headers := make([]*containerHeader, len(covers))
+	payloads := make([][]byte, len(covers))
+	offset := 0
+	for i := range covers {
+		shardHeader := *header
+		shardHeader.shard = &shardInfo{setID: setID, seq: i + 1, count: len(covers)}
+		headers[i], payloads[i] = &shardHeader, payload[offset:offset+parts[i]]
+		offset += parts[i]
+	}
+	return s.embedSet(req, decoded, headers, payloads)
+}
+
+// ExtractShards reads one shard from every stego file, in any order, and reassembles the secret.
+// The report lists the shards found and missing; if any are missing ErrIncompleteShardSet is
+// returned together with the report.
+func (s *stegoService) ExtractShards(req *models.ExtractRequest, stegoFiles [][]byte) (*models.ExtractResponse, *models.ShardSetReport, error) {
+	if len(stegoFiles) == 0 {
+		return nil, nil, models.ErrExtractionFailed
+	}
+
+	var set *shardInfo
+	shards := make(map[int]*extractedContainer)
+	for i, data := range stegoFiles {
+		c, err := s.extractContainer(req, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("stego file %d: %w", i+1, err)
+		}
+		shard := c.header.shard
+		if shard == nil || (set != nil && (shard.setID != set.setID || shard.count != set.count)) {
+			return nil, nil, fmt.Errorf("stego file %d: %w", i+1, models.ErrShardSetMismatch)
+		}
+		if shard.seq < 1 || shard.seq > shard.count {
+			return nil, nil, fmt.Errorf("stego file %d: %w", i+1, models.ErrCorruptedData)
+		}
+		set = shard
+		shards[shard.seq] = c // the same shard uploaded twice is read twice but kept once
+	}
+
+	report := &models.ShardSetReport{SetID: hex.EncodeToString(set.setID[:]), Count: set.count, Found: []int{}, Missing: []int{}}
+	for seq := 1; seq <= set.count; seq++ {
+		if shards[seq] != nil {
+			report.Found = append(report.Found, seq)
+		} else {
+			report.Missing = append(report.Missing, seq)
+		}
+	}
+	if len(report.Missing) > 0 {
+		return nil, report, models.ErrIncompleteShardSet
+	}
+
+	// the set is reported with the least trustworthy signature of its shards
+	var payload bytes.Buffer
+	signature := shards[1].signature
+	for seq := 1; seq <= set.count; seq++ {
+		payload.Write(shards[seq].payload)
+		signature = signature.Weakest(shards[seq].signature)
+	}
+	result, err := finishExtraction(shards[1].header, payload.Bytes(), shards[1].version)
+	if err != nil {
+		return nil, report, err
+	}
+	result.Signature = signature
+	return result, report, nil
+}
+
+// newSetID returns a random identifier for a shard or share set
+func newSetID() ([shardSetIDSize]byte, error) {
+	var setID [shardSetIDSize]byte
+	_, err := rand.Read(setID[:])
+	return setID, err
+}
+
+// decodeCovers decodes MP3 covers to WAV once when req.DecodeToPCM is set or the method works on
+// the signal, so capacities are measured on the carrier that is actually used
+func (s *stegoService) decodeCovers(req *models.EmbedRequest, covers [][]byte) ([][]byte, error) {
+	if !req.DecodeToPCM && !req.Method.IsSignalDomain() {
+		return covers, nil
+	}
+	decoded := make([][]byte, len(covers))
+	for i, cover := range covers {
+		var err error
+		if decoded[i], err = s.DecodeToWAV(cover); err != nil {
+			return nil, err
+		}
+	}
+	return decoded, nil
+}
+
+// embedSet embeds payloads[i] under headers[i] into covers[i], which are already decoded, and
+// returns the stego files with their PSNR and SNR
+func (s *stegoService) embedSet(req *models.EmbedRequest, covers [][]byte, headers []*containerHeader, payloads [][]byte) ([][]byte, []models.Distortion, error) {
+	stegoFiles := make([][]byte, len(covers))
+	distortions := make([]models.Distortion, len(covers))
+	for i, cover := range covers {
+		coverReq := *req
+		coverReq.CoverAudio, coverReq.DecodeToPCM = cover, false
+		var err error
+		if stegoFiles[i], distortions[i], err = s.embedContainer(&coverReq, headers[i], payloads[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return stegoFiles, distortions, nil
+}
+
+// payloadCapacity returns how many payload bytes fit into cover under header once the key preamble,
+// header, encryption overhead, signature, integrity tag and ECC parity are accounted for
+func (s *stegoService) payloadCapacity(req *models.EmbedRequest, cover []byte, header *containerHeader) (int, error) {
+	indices, err := collectCoverIndices(cover)
+	if err != nil {
+		return 0, err
+	}
+	carrier, err := newCarrier(cover, indices, req.Method, header.nLsb, req.StegoKey, dsssParams(req).Gain)
+	if err != nil {
+		return 0, err
+	}
+
+	nsym := req.ECC.ParityBytes()
+	preambleSize := 0
+	probe := *header
+	if req.StegoKey != "" {
+		preambleSize = keyPreambleSize
+		if !req.PublicHeader {
+			preambleSize = hiddenPreambleSize
+		}
+		if nsym > 0 {
+			preambleSize += preambleParity
+		}
+		probe.keyCheck = make([]byte, keyCheckSize)
+	}
+	probe.recipients = make([][]byte, len(req.Recipients))
+	for i := range probe.recipients {
+		probe.recipients[i] = make([]byte, recipientStanzaSize)
+	}
+	if req.SigningKey != nil {
+		probe.signer = make([]byte, 32)
+	}
+	headerBytes, err := probe.encode()
+	if err != nil {
+		return 0, err
+	}
+
+	containerSize := eccCapacity(carrier.capacity()/8-preambleSize, nsym)
+	return max(containerSize-len(headerBytes)-probe.signatureLen()-integrityTagSize-encryptionOverhead(req), 0), nil
+}
+
+// splitProportionally divides total bytes into parts proportional to capacities, never exceeding a
+// capacity. The sum of capacities must be at least total.
+func splitProportionally(total int, capacities []int) []int {
+	sum := 0
+	for _, c := range capacities {
+		sum += c
+	}
+	parts := make([]int, len(capacities))
+	if sum == 0 {
+		return parts
+	}
+	assigned := 0
+	for i, c := range capacities {
+		parts[i] = int(int64(total) * int64(c) / int64(sum))
+		assigned += parts[i]
+	}
+	// hand out the bytes lost to rounding
+	for i := 0; assigned < total; i = (i + 1) % len(parts) {
+		if parts[i] < capacities[i] {
+			parts[i]++
+			assigned++
+		}
+	}
+	return parts
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+/*
+ Share sets: the secret is packed into a complete unkeyed container (header with filename, MIME
+ type, directory..., compressed payload and SHA-256 tag) and that container is split with Shamir
+ secret sharing (see shamir.go). Every cover receives one share in a container of its own, with its
+ own key preamble, encryption, integrity tag and ECC, whose share TLV records the set id, the share
+ index, the threshold and the share count. Any threshold shares rebuild the inner container; with
+ fewer, the secret and its metadata stay hidden, only their total size is known.
+*/
+
+// EmbedShares splits secretData into one share per cover so that any threshold of the returned
+// stego files recover it. Stego files are returned in cover order with the PSNR and SNR of each.
+func (s *stegoService) EmbedShares(req *models.EmbedRequest, covers [][]byte, secretData []byte, metadata []byte, threshold int) ([][]byte, []models.Distortion, error) {
+	if threshold < 2 || threshold > len(covers) || len(covers) > 255 {
+		return nil, nil, models.ErrInvalidThreshold
+	}
+	if err := validateEmbedRequest(req); err != nil {
+		return nil, nil, err
+	}
+	header, payload, err := prepareSecret(req, secretData, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The shared secret is an unkeyed container: keys, encryption and ECC apply to the share
+	// containers, the inner one only carries the metadata, the payload and its SHA-256 tag
+	inner := *header
+	inner.flags, inner.eccParams, inner.payloadLen = 0, nil, len(payload)
+	innerHeader, err := inner.encode()
+	if err != nil {
+		return nil, nil, err
+	}
+	secret := append(innerHeader, payload...)
+	secret = append(secret, integrityTag(nil, secret)...)
+
+	shares, err := shamirSplit(secret, threshold, len(covers))
+	if err != nil {
+		return nil, nil, err
+	}
+	setID, err := newSetID()
+	if err != nil {
+		return nil, nil, err
+	}
+	shareHeader := func(index int) *containerHeader {
+		return &containerHeader{
+			method:    header.method,
+			nLsb:      header.nLsb,
+			flags:     header.flags,
+			eccParams: header.eccParams,
+			share:     &shareInfo{setID: setID, index: index, threshold: threshold, count: len(covers)},
+		}
+	}
+
+	// every cover has to hold a whole share
+	decoded, err := s.decodeCovers(req, covers)
+	if err != nil {
+		return nil, nil, err
+	}
+	headers := make([]*containerHeader, len(covers))
+	for i, cover := range decoded {
+		headers[i] = shareHeader(i + 1)
+		capacity, err := s.payloadCapacity(req, cover, headers[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if capacity < len(secret) {
+			return nil, nil, models.ErrInsufficientCapacity
+		}
+	}
+	return s.embedSet(req, decoded, headers, shares)
+}
+
+// ExtractShares reads one share from every stego file, in any order, and recovers the secret once
+// the threshold is reached. The report lists the distinct shares found; if too few are present
+// ErrNotEnoughShares is returned together with the report.
+func (s *stegoService) ExtractShares(req *models.ExtractRequest, stegoFiles [][]byte) (*models.ExtractResponse, *models.ShareSetReport, error) {
+	if len(stegoFiles) == 0 {
+		return nil, nil, models.ErrExtractionFailed
+	}
+
+	var set *shareInfo
+	var signature models.SignatureInfo
+	shares := make(map[int][]byte)
+	for i, data := range stegoFiles {
+		c, err := s.extractContainer(req, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("stego file %d: %w", i+1, err)
+		}
+		share := c.header.share
+		if share == nil || (set != nil && (share.setID != set.setID || share.threshold != set.threshold || share.count != set.count)) {
+			return nil, nil, fmt.Errorf("stego file %d: %w", i+1, models.ErrShareSetMismatch)
+		}
+		if share.index < 1 || share.index > share.count || share.threshold < 2 || share.threshold > share.count {
+			return nil, nil, fmt.Errorf("stego file %d: %w", i+1, models.ErrCorruptedData)
+		}
+		if set == nil {
+			signature = c.signature
+		}
+		set, signature = share, signature.Weakest(c.signature)
+		shares[share.index] = c.payload // the same share uploaded twice counts once
+	}
+
+	report := &models.ShareSetReport{SetID: hex.EncodeToString(set.setID[:]), Threshold: set.threshold, Count: set.count, Found: []int{}}
+	for index := range shares {
+		report.Found = append(report.Found, index)
+	}
+	sort.Ints(report.Found)
+	report.Needed = max(set.threshold-len(report.Found), 0)
+	if report.Needed > 0 {
+		return nil, report, models.ErrNotEnoughShares
+	}
+
+	// any threshold shares determine the polynomials, the lowest indices are used
+	xs := make([]byte, set.threshold)
+	ys := make([][]byte, set.threshold)
+	for i, index := range report.Found[:set.threshold] {
+		xs[i], ys[i] = byte(index), shares[index]
+	}
+	secret, err := shamirCombine(xs, ys)
+	if err != nil {
+		return nil, report, models.ErrCorruptedData
+	}
+
+	// shares that do not belong together interpolate to noise instead of a container
+	header, payloadOffset, err := readContainerHeader(bytesSource(secret))
+	if err != nil || payloadOffset+header.payloadLen+integrityTagSize != len(secret) {
+		return nil, report, models.ErrCorruptedData
+	}
+	data, tag := secret[:payloadOffset+header.payloadLen], secret[payloadOffset+header.payloadLen:]
+	if !hmac.Equal(tag, integrityTag(nil, data)) {
+		return nil, report, models.ErrIntegrityFailed
+	}
+	result, err := finishExtraction(header, data[payloadOffset:], containerVersion)
+	if err != nil {
+		return nil, report, err
+	}
+	// the secret is reported with the least trustworthy signature of the uploaded shares
+	result.Signature = signature
+	return result, report, nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"encoding/binary"
+	"math"
+	"math/cmplx"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// pcmSignal gives the signal-domain methods access to the 16-bit samples of a WAV cover. Samples are
+// changed in place; the samples of the untouched cover are kept, so a slot can be rewritten from the
+// original however often it is set.
+type pcmSignal struct {
+	data     []byte
+	offset   int // first byte of the data chunk
+	channels int
+	frames   int     // samples per channel
+	original []int16 // interleaved samples before embedding
+}
+
+// parsePCMLayout returns where the samples of a 16-bit PCM WAV file start, its channel count and
+// the number of samples per channel
+func parsePCMLayout(data []byte) (offset, channels, frames int, err error) {
+	if !isWAVData(data) {
+		return 0, 0, 0, models.ErrUnsupportedFormat
+	}
+	formatTag, channels, _, bitsPerSample, err := parseWAVFormat(data)
+	if err != nil || (formatTag != 1 && formatTag != 0xFFFE) || bitsPerSample != 16 || channels < 1 {
+		return 0, 0, 0, models.ErrInvalidWAV
+	}
+	dataOffset, dataSize, err := parseWAVHeader(data)
+	if err != nil {
+		return 0, 0, 0, models.ErrInvalidWAV
+	}
+	end := dataOffset + int(dataSize)
+	if end > len(data) {
+		end = len(data) // tolerate truncated data chunks
+	}
+	return dataOffset, channels, (end - dataOffset) / (2 * channels), nil
+}
+
+// newPCMSignal wraps the samples of a 16-bit PCM WAV cover
+func newPCMSignal(cover []byte) (*pcmSignal, error) {
+	offset, channels, frames, err := parsePCMLayout(cover)
+	if err != nil {
+		return nil, err
+	}
+	original := make([]int16, frames*channels)
+	for i := range original {
+		original[i] = int16(binary.LittleEndian.Uint16(cover[offset+2*i:]))
+	}
+	return &pcmSignal{data: cover, offset: offset, channels: channels, frames: frames, original: original}, nil
+}
+
+// originalSample returns a sample of the cover as it was before embedding
+func (p *pcmSignal) originalSample(frame, ch int) float64 {
+	return float64(p.original[frame*p.channels+ch])
+}
+
+// setSample stores v rounded and clipped to the 16-bit range
+func (p *pcmSignal) setSample(frame, ch int, v float64) {
+	v = math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v)))
+	binary.LittleEndian.PutUint16(p.data[p.offset+2*(frame*p.channels+ch):], uint16(int16(v)))
+}
+
+// sample returns the current value of a sample
+func (p *pcmSignal) sample(frame, ch int) float64 {
+	return float64(int16(binary.LittleEndian.Uint16(p.data[p.offset+2*(frame*p.channels+ch):])))
+}
+
+// mix returns the current samples of n frames from start, averaged over the channels
+func (p *pcmSignal) mix(start, n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		for ch := 0; ch < p.channels; ch++ {
+			out[i] += p.sample(start+i, ch)
+		}
+		out[i] /= float64(p.channels)
+	}
+	return out
+}
+
+// fft transforms x in place with the iterative radix-2 Cooley–Tukey algorithm; len(x) must be a power
+// of two. The inverse transform is scaled by 1/len(x).
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	// bit-reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
+
+// realCepstrum returns the real cepstrum of the Hann-windowed samples, whose length must be a power of two
+func realCepstrum(samples []float64) []float64 {
+	n := len(samples)
+	spectrum := make([]complex128, n)
+	for i, v := range samples {
+		spectrum[i] = complex(v*(0.5-0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))), 0)
+	}
+	fft(spectrum, false)
+	for i, v := range spectrum {
+		spectrum[i] = complex(math.Log(cmplx.Abs(v)+1e-9), 0)
+	}
+	fft(spectrum, true)
+	cepstrum := make([]float64, n)
+	for i, v := range spectrum {
+		cepstrum[i] = real(v)
+	}
+	return cepstrum
+}
@@ -2,44 +2,68 @@ package service
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
-	"math/rand"
+	"fmt"
+	"log"
+	mathrand "math/rand"
+	"time"
 
 	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
 )
 
 // Implementation struct which depends on Crypto and Audio services
 type stegoService struct {
-	crypto CryptographyService
-	audio  AudioService
+	crypto  CryptographyService
+	audio   AudioService
+	encoder AudioEncoder
 }
 
-func NewStegoService(crypto CryptographyService, audio AudioService) SteganographyService {
-	return &stegoService{crypto: crypto, audio: audio}
+func NewStegoService(crypto CryptographyService, audio AudioService, encoder AudioEncoder) SteganographyService {
+	return &stegoService{crypto: crypto, audio: audio, encoder: encoder}
 }
 
 /*
- Format header (binary, fixed order):
+ Legacy format header v2 (binary, fixed order), only read for stego files from older versions.
+ New embeddings use the v3 container described in container.go.
  - 8 bytes magic: "ASTEGv2\000" (8 bytes) - v2 to support multiple methods
- - 1 byte method: 0=LSB, 1=Parity
+ - 1 byte method: 0=LSB, 1=Parity, 2=Bitstream
  - 1 byte nLSB (1..4, only used for LSB method)
- - 1 byte flags: bit0 = UseEncryption, bit1 = UseRandomStart
+ - 1 byte flags: bit0 = UseEncryption, bit1 = UseRandomStart, bit2-3 = cipher id (when encrypted),
+                 bit4 = keys derived with the KDF (a key preamble precedes the header, see layout.go),
+                 bit5 = Scatter (container bits follow a keyed permutation of the carrier)
  - 2 bytes filename length (uint16 big endian)
  - 4 bytes secret payload length (uint32 big endian)  <-- length AFTER encryption (i.e. stored)
  - filename bytes (utf-8) [filename length]
+ - 2 bytes metadata length (uint16 big endian) and metadata bytes
  - secret bytes ...
 */
 
 // helper constants
 var (
-	magicBytes = []byte("ASTEGv2\x00")
+	magicV2 = []byte("ASTEGv2\x00")
 )
 
 // method constants
 const (
-	methodLSB    = 0
-	methodParity = 1
+	methodLSB         = 0
+	methodParity      = 1
+	methodBitstream   = 2
+	methodLSBMatching = 3
+	methodEcho        = 4
+	methodPhase       = 5
+	methodDSSS        = 6
+	methodQIM         = 7
+	methodDCT         = 8
+)
+
+// cipher constants (flags bits 2-3, only meaningful when the encryption flag is set)
+const (
+	cipherXOR      = 0 // repeating-key XOR written by older versions, never used for new embeddings
+	cipherVigenere = 1
+	cipherAESGCM   = 2
 )
 
 // ------------------ Helpers ------------------
@@ -65,15 +89,95 @@ func parseID3v2Size(data []byte) int {
 	if string(data[0:3]) != "ID3" {
 		return 0
 	}
-	// synchsafe size in bytes 6..9 (4 bytes)
-	if len(data) < 10 {
-		return 0
+	size := 10 + synchsafeSize(data[6:10])
+	// footer present flag (ID3v2.4) adds a 10-byte "3DI" footer after the tag
+	if data[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+// synchsafeSize decodes a 4-byte synchsafe integer (7 bits per byte) as used by ID3v2
+func synchsafeSize(b []byte) int {
+	return int((uint32(b[0])&0x7F)<<21 |
+		(uint32(b[1])&0x7F)<<14 |
+		(uint32(b[2])&0x7F)<<7 |
+		(uint32(b[3]) & 0x7F))
+}
+
+// parseTrailerTagSize returns the size of a metadata tag that ends exactly at end, or 0 if none.
+// Recognised trailers are ID3v1 (with optional Enhanced "TAG+" block), APEv2, Lyrics3 v1/v2
+// and ID3v2 tags appended at the end of the file (identified by their "3DI" footer).
+func parseTrailerTagSize(data []byte, end int) int {
+	// ID3v1: fixed 128 bytes starting with "TAG", optionally preceded by a 227-byte "TAG+" block
+	if end >= 128 && string(data[end-128:end-125]) == "TAG" {
+		size := 128
+		if end >= 128+227 && string(data[end-355:end-351]) == "TAG+" {
+			size += 227
+		}
+		return size
+	}
+
+	// APEv2: 32-byte footer "APETAGEX"; size field counts items and footer, flag bit 31 adds a header
+	if end >= 32 && string(data[end-32:end-24]) == "APETAGEX" {
+		footer := data[end-32 : end]
+		size := int(binary.LittleEndian.Uint32(footer[12:16]))
+		if binary.LittleEndian.Uint32(footer[20:24])&(1<<31) != 0 {
+			size += 32
+		}
+		if size >= 32 && size <= end {
+			return size
+		}
+	}
+
+	// Lyrics3 v2: "LYRICSBEGIN" ... 6-digit size + "LYRICS200"
+	if end >= 15 && string(data[end-9:end]) == "LYRICS200" {
+		size := 0
+		for _, ch := range data[end-15 : end-9] {
+			if ch < '0' || ch > '9' {
+				size = -1
+				break
+			}
+			size = size*10 + int(ch-'0')
+		}
+		if size >= 11 && size+15 <= end && string(data[end-15-size:end-15-size+11]) == "LYRICSBEGIN" {
+			return size + 15
+		}
+	}
+
+	// Lyrics3 v1: "LYRICSBEGIN" ... "LYRICSEND", at most 5100 bytes of lyrics
+	if end >= 9 && string(data[end-9:end]) == "LYRICSEND" {
+		searchStart := end - 9 - 5100 - 11
+		if searchStart < 0 {
+			searchStart = 0
+		}
+		if begin := bytes.LastIndex(data[searchStart:end-9], []byte("LYRICSBEGIN")); begin >= 0 {
+			return end - (searchStart + begin)
+		}
+	}
+
+	// Appended ID3v2 tag: 10-byte footer "3DI" with the same synchsafe size as the header
+	if end >= 20 && string(data[end-10:end-7]) == "3DI" {
+		size := 10 + synchsafeSize(data[end-4:end]) + 10
+		if size <= end && string(data[end-size:end-size+3]) == "ID3" {
+			return size
+		}
+	}
+
+	return 0
+}
+
+// findAudioEnd returns the offset just after the last audio byte, i.e. the file length minus all
+// trailing metadata tags. Tags may be stacked (e.g. APEv2 followed by Lyrics3 and ID3v1).
+func findAudioEnd(data []byte) int {
+	end := len(data)
+	for {
+		size := parseTrailerTagSize(data, end)
+		if size == 0 {
+			return end
+		}
+		end -= size
 	}
-	size := int((uint32(data[6])&0x7F)<<21 |
-		(uint32(data[7])&0x7F)<<14 |
-		(uint32(data[8])&0x7F)<<7 |
-		(uint32(data[9]) & 0x7F))
-	return 10 + size
 }
 
 // parseMP3FrameSize parses the MP3 frame header at pos and returns the frame size in bytes.
@@ -177,14 +281,43 @@ func parseMP3FrameSize(data []byte, pos int) int {
 	return frameSize
 }
 
+// findFirstFrame returns the offset of the first valid MP3 frame header after any ID3v2 tag,
+// or -1 if the data does not contain an MP3 frame.
+func findFirstFrame(data []byte) int {
+	end := findAudioEnd(data)
+	for i := parseID3v2Size(data); i < end-4; i++ {
+		if isFrameSyncAt(data, i) && parseMP3FrameSize(data, i) > 4 && i+parseMP3FrameSize(data, i) <= end {
+			return i
+		}
+	}
+	return -1
+}
+
 // collectPayloadIndices returns a slice of indices of bytes that are considered "payload bytes"
-// i.e., bytes between frame header and end of frame. This uses proper frame size calculation for robustness.
+// i.e., the main data of each frame. The 4-byte header, the optional 16-bit CRC and the Layer III
+// side information are excluded, and Xing/Info/LAME/VBRI tag frames are skipped entirely, so the
+// frame structure, seek tables and gapless info survive embedding.
 func collectPayloadIndices(data []byte) []int {
 	var indices []int
-	// start after ID3 tag
-	start := parseID3v2Size(data)
-	i := start
-	for i < len(data)-4 { // need at least header size
+	for _, f := range collectMP3Frames(data) {
+		if isVBRTagFrame(data, f) {
+			continue
+		}
+		// add payload bytes: from end of side info to end of frame
+		for j := f.sideInfoOffset() + f.sideInfoSize(); j < f.offset+f.size && j < len(data); j++ {
+			indices = append(indices, j)
+		}
+	}
+	return indices
+}
+
+// collectLegacyPayloadIndices returns the payload bytes used by versions before side info and VBR
+// tag frames were excluded: every byte after the 4-byte header of every frame. Only used to find
+// the containers of stego files from those versions.
+func collectLegacyPayloadIndices(data []byte) []int {
+	var indices []int
+	i := parseID3v2Size(data)
+	for i < len(data)-4 {
 		if !isFrameSyncAt(data, i) {
 			i++
 			continue
@@ -194,374 +327,1245 @@ func collectPayloadIndices(data []byte) []int {
 			i++
 			continue
 		}
-		// add payload bytes: from i+4 to i+size-1
 		for j := i + 4; j < i+size && j < len(data); j++ {
 			indices = append(indices, j)
 		}
-		// jump to next frame
 		i += size
 	}
 	return indices
 }
 
-// deterministicStartIndex chooses deterministic start bit index from key and capacityBits
+// collectWAVSampleIndices returns the index of the low (least significant) byte of every
+// 16-bit PCM sample in the WAV data chunk, so LSB and parity embedding modify sample LSBs
+// while the RIFF header and other chunks are left untouched.
+func collectWAVSampleIndices(data []byte) ([]int, error) {
+	formatTag, _, _, bitsPerSample, err := parseWAVFormat(data)
+	if err != nil {
+		return nil, err
+	}
+	// 1 = PCM, 0xFFFE = WAVE_FORMAT_EXTENSIBLE (integer PCM sub-format)
+	if (formatTag != 1 && formatTag != 0xFFFE) || bitsPerSample != 16 {
+		return nil, models.ErrInvalidWAV
+	}
+	dataOffset, dataSize, err := parseWAVHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	end := dataOffset + int(dataSize)
+	if end > len(data) {
+		end = len(data) // tolerate truncated data chunks
+	}
+	indices := make([]int, 0, (end-dataOffset)/2)
+	for i := dataOffset; i+1 < end; i += 2 {
+		indices = append(indices, i) // little-endian: low byte comes first
+	}
+	return indices, nil
+}
+
+// collectCoverIndices returns the carrier byte indices of the cover, using the WAV sample
+// walker for RIFF/WAVE data and the MP3 frame walker otherwise.
+func collectCoverIndices(data []byte) ([]int, error) {
+	if isWAVData(data) {
+		indices, err := collectWAVSampleIndices(data)
+		if err != nil || len(indices) == 0 {
+			log.Printf("[WARN] collectCoverIndices: WAV cover rejected: %v", err)
+			return nil, models.ErrInvalidWAV
+		}
+		return indices, nil
+	}
+	indices := collectPayloadIndices(data)
+	if len(indices) == 0 {
+		return nil, models.ErrInvalidMP3
+	}
+	return indices, nil
+}
+
+// DecodeToWAV decodes an MP3 cover to PCM and repackages it as a 16-bit WAV file with the
+// stream's own sample rate and channel count. WAV input is returned unchanged.
+func (s *stegoService) DecodeToWAV(audioData []byte) ([]byte, error) {
+	if isWAVData(audioData) {
+		return audioData, nil
+	}
+	pcmData, sampleRate, channels, err := s.audio.DecodeMP3(audioData)
+	if err != nil {
+		return nil, err
+	}
+	return s.encoder.EncodeToWAV(pcmData, sampleRate, channels)
+}
+
+// pcmRegion returns the part of the file that holds audio samples (the WAV data chunk),
+// or the whole file for MP3, so PSNR is not skewed by container headers.
+func pcmRegion(data []byte) []byte {
+	if !isWAVData(data) {
+		return data
+	}
+	dataOffset, dataSize, err := parseWAVHeader(data)
+	if err != nil {
+		return data
+	}
+	end := dataOffset + int(dataSize)
+	if end > len(data) {
+		end = len(data)
+	}
+	return data[dataOffset:end]
+}
+
+// methodID maps a steganography method to the method byte stored in the header
+func methodID(method models.SteganographyMethod) int {
+	switch method {
+	case models.MethodParity:
+		return methodParity
+	case models.MethodBitstream:
+		return methodBitstream
+	case models.MethodLSBMatching:
+		return methodLSBMatching
+	case models.MethodEcho:
+		return methodEcho
+	case models.MethodPhase:
+		return methodPhase
+	case models.MethodDSSS:
+		return methodDSSS
+	case models.MethodQIM:
+		return methodQIM
+	case models.MethodDCT:
+		return methodDCT
+	default:
+		return methodLSB
+	}
+}
+
+// newCarrier builds the bit carrier used by method on cover. indices are the carrier byte
+// indices from collectCoverIndices and are only used by the LSB, Parity and LSB matching methods.
+// Signal-domain methods need a WAV cover. n is the nLSB byte of the header: the number of LSBs for
+// the LSB method, the chip rate exponent for DSSS, whose chips are keyed with stegoKey and added
+// with gain when embedding, and the step exponent for QIM, whose dither is keyed with stegoKey.
+func newCarrier(cover []byte, indices []int, method models.SteganographyMethod, n int, stegoKey string, gain float64) (bitCarrier, error) {
+	switch method {
+	case models.MethodLSB:
+		return &lsbCarrier{data: cover, indices: indices, nLsb: n}, nil
+	case models.MethodParity:
+		return &parityCarrier{data: cover, indices: indices}, nil
+	case models.MethodBitstream:
+		if isWAVData(cover) {
+			return nil, models.ErrUnsupportedFormat
+		}
+		positions := collectGlobalGainBits(cover)
+		if len(positions) == 0 {
+			return nil, models.ErrInvalidMP3
+		}
+		return &bitPositionCarrier{data: cover, positions: positions}, nil
+	case models.MethodLSBMatching:
+		// the direction of every ±1 step only has to be unpredictable, not reproducible
+		var seed [8]byte
+		if _, err := rand.Read(seed[:]); err != nil {
+			return nil, err
+		}
+		rng := mathrand.New(mathrand.NewSource(int64(binary.BigEndian.Uint64(seed[:]))))
+		return &matchingCarrier{data: cover, indices: indices, samples: isWAVData(cover), rng: rng}, nil
+	case models.MethodEcho:
+		signal, err := newPCMSignal(cover)
+		if err != nil {
+			return nil, err
+		}
+		return &echoCarrier{signal: signal}, nil
+	case models.MethodPhase:
+		signal, err := newPCMSignal(cover)
+		if err != nil {
+			return nil, err
+		}
+		return newPhaseCarrier(signal), nil
+	case models.MethodDSSS:
+		signal, err := newPCMSignal(cover)
+		if err != nil {
+			return nil, err
+		}
+		return newDSSSCarrier(signal, n, stegoKey, gain)
+	case models.MethodQIM:
+		signal, err := newPCMSignal(cover)
+		if err != nil {
+			return nil, err
+		}
+		return newQIMCarrier(signal, n, stegoKey)
+	case models.MethodDCT:
+		signal, err := newPCMSignal(cover)
+		if err != nil {
+			return nil, err
+		}
+		return newDCTCarrier(signal), nil
+	default:
+		return nil, models.ErrInvalidMethod
+	}
+}
+
+// deterministicStartIndex chooses deterministic start bit index from key and capacityBits.
+// Only used to locate the container in stego files created before key derivation was introduced.
 func deterministicStartIndex(key string, capacityBits int) int {
 	if capacityBits == 0 {
 		return 0
 	}
 	h := sha256.Sum256([]byte(key))
 	seed := int64(binary.BigEndian.Uint64(h[:8]))
-	r := rand.New(rand.NewSource(seed))
+	r := mathrand.New(mathrand.NewSource(seed))
 	return r.Intn(capacityBits)
 }
 
 // ------------------ Interface Implementations ------------------
 
-// CalculateCapacity calculates available embedding capacity for both LSB and Parity methods (in bytes).
-func (s *stegoService) CalculateCapacity(audioData []byte) (*models.CapacityResult, error) {
+// CalculateCapacity calculates available embedding capacity for the LSB, Parity, Bitstream, LSB matching, Echo, Phase, DSSS, QIM and DCT methods (in bytes).
+// For WAV covers every 16-bit sample counts as one carrier byte; for MP3 covers only frame main data
+// counts, i.e. headers, CRC words, side information and VBR tag frames are excluded. Echo hiding,
+// phase coding, DSSS, QIM and DCT work on the decoded audio, so MP3 covers are decoded to measure them. The
+// DSSS capacity is given for chipRate, 0 selects the default chip rate.
+func (s *stegoService) CalculateCapacity(audioData []byte, chipRate int) (*models.CapacityResult, error) {
 	if len(audioData) == 0 {
 		return nil, models.ErrInvalidMP3
 	}
-	indices := collectPayloadIndices(audioData)
-	if len(indices) == 0 {
-		return nil, models.ErrInvalidMP3
+	if chipRate == 0 {
+		chipRate = models.DefaultDSSSParams().ChipRate
+	}
+	if !models.IsValidChipRate(chipRate) {
+		return nil, models.ErrInvalidDSSSParams
+	}
+	indices, err := collectCoverIndices(audioData)
+	if err != nil {
+		return nil, err
 	}
 	totalPayloadBytes := len(indices)
 	// capacity for n LSB = floor(totalPayloadBytes * n / 8) bytes
 	// capacity for parity = floor(totalPayloadBytes / 8) bytes (1 bit per byte)
 	res := &models.CapacityResult{
-		OneLSB:   (totalPayloadBytes * 1) / 8,
-		TwoLSB:   (totalPayloadBytes * 2) / 8,
-		ThreeLSB: (totalPayloadBytes * 3) / 8,
-		FourLSB:  (totalPayloadBytes * 4) / 8,
-		Parity:   totalPayloadBytes / 8, // 1 bit per byte
+		OneLSB:      (totalPayloadBytes * 1) / 8,
+		TwoLSB:      (totalPayloadBytes * 2) / 8,
+		ThreeLSB:    (totalPayloadBytes * 3) / 8,
+		FourLSB:     (totalPayloadBytes * 4) / 8,
+		Parity:      totalPayloadBytes / 8, // 1 bit per byte
+		LSBMatching: totalPayloadBytes / 8, // 1 bit per byte
+	}
+	if !isWAVData(audioData) {
+		res.Bitstream = len(collectGlobalGainBits(audioData)) / 8 // 1 bit per granule and channel
 	}
+	if pcm, err := s.DecodeToWAV(audioData); err == nil {
+		if signal, err := newPCMSignal(pcm); err == nil {
+			frames, channels := signal.frames, signal.channels
+			res.Echo = frames / echoSegment / 8                              // 1 bit per segment
+			res.Phase = newPhaseCarrier(signal).capacity() / 8               // 1 bit per band bin of the first loud segment
+			res.DSSS, res.ChipRate = dsssSlots(frames, chipRate)/8, chipRate // 1 bit per chipRate samples after the probe
+			res.QIM = frames * channels / 8                                  // 1 bit per sample
+			res.DCT = frames / dctBlock * channels * dctBandSize / 8         // 1 bit per band coefficient
+		}
+	}
+
+	// every layer of a deniable embedding gets half of the carrier slots; keyed methods cannot be
+	// embedded deniably
+	res.Layer = &models.CapacityResult{
+		OneLSB:      res.OneLSB / deniableLayers,
+		TwoLSB:      res.TwoLSB / deniableLayers,
+		ThreeLSB:    res.ThreeLSB / deniableLayers,
+		FourLSB:     res.FourLSB / deniableLayers,
+		Parity:      res.Parity / deniableLayers,
+		Bitstream:   res.Bitstream / deniableLayers,
+		LSBMatching: res.LSBMatching / deniableLayers,
+		Echo:        res.Echo / deniableLayers,
+		Phase:       res.Phase / deniableLayers,
+		DCT:         res.DCT / deniableLayers,
+	}
+	res.ECC, res.Layer.ECC = eccCapacities(res), eccCapacities(res.Layer)
 	return res, nil
 }
 
-// EmbedMessage embeds secretData (and metadata) into req.CoverAudio using LSB or Parity method.
-func (s *stegoService) EmbedMessage(req *models.EmbedRequest, secretData []byte, metadata []byte) ([]byte, float64, error) {
+// eccCapacities returns the effective capacity per ECC level: every 255 carrier bytes hold 255-n
+// container bytes
+func eccCapacities(res *models.CapacityResult) map[models.ECCLevel]*models.CapacityResult {
+	ecc := make(map[models.ECCLevel]*models.CapacityResult)
+	for _, level := range models.GetECCLevels() {
+		nsym := level.ParityBytes()
+		ecc[level] = &models.CapacityResult{
+			OneLSB:      eccCapacity(res.OneLSB, nsym),
+			TwoLSB:      eccCapacity(res.TwoLSB, nsym),
+			ThreeLSB:    eccCapacity(res.ThreeLSB, nsym),
+			FourLSB:     eccCapacity(res.FourLSB, nsym),
+			Parity:      eccCapacity(res.Parity, nsym),
+			Bitstream:   eccCapacity(res.Bitstream, nsym),
+			LSBMatching: eccCapacity(res.LSBMatching, nsym),
+			Echo:        eccCapacity(res.Echo, nsym),
+			Phase:       eccCapacity(res.Phase, nsym),
+			DSSS:        eccCapacity(res.DSSS, nsym),
+			QIM:         eccCapacity(res.QIM, nsym),
+			DCT:         eccCapacity(res.DCT, nsym),
+		}
+	}
+	return ecc
+}
+
+// EstimateSecretSize returns how many bytes the secret occupies in the container after compression,
+// for comparison with the capacities reported by CalculateCapacity
+func (s *stegoService) EstimateSecretSize(secretData []byte) int {
+	compressed, _ := compressSecret(secretData)
+	return len(compressed)
+}
+
+// SecretFits reports whether secretData fits into req.CoverAudio with the options of req. The
+// compressed secret is compared against the payload capacity left once the key preamble, header,
+// encryption overhead, signature, integrity tag and ECC parity are accounted for, as when embedding.
+func (s *stegoService) SecretFits(req *models.EmbedRequest, secretData []byte) (bool, error) {
+	if err := validateEmbedRequest(req); err != nil {
+		return false, err
+	}
+	header, payload, err := prepareSecret(req, secretData, nil)
+	if err != nil {
+		return false, err
+	}
+	cover, err := s.coverAudio(req)
+	if err != nil {
+		return false, err
+	}
+	capacity, err := s.payloadCapacity(req, cover, header)
+	if err != nil {
+		return false, err
+	}
+	return len(payload) <= capacity, nil
+}
+
+// EmbedMessage embeds secretData (and metadata) into req.CoverAudio using the given method.
+// MP3 covers are modified in their frame payload bytes, WAV covers in their 16-bit PCM samples;
+// the returned stego audio keeps the container format of the cover unless req.DecodeToPCM is set
+// or the method is signal-domain, in which case MP3 covers are decoded and the result is returned as WAV.
+// If req.SecretEntries is set, those files are embedded with a directory instead of secretData.
+func (s *stegoService) EmbedMessage(req *models.EmbedRequest, secretData []byte, metadata []byte) ([]byte, models.Distortion, error) {
+	if err := validateEmbedRequest(req); err != nil {
+		return nil, models.Distortion{}, err
+	}
+	header, payload, err := prepareSecret(req, secretData, metadata)
+	if err != nil {
+		return nil, models.Distortion{}, err
+	}
+	return s.embedContainer(req, header, payload)
+}
+
+// validateEmbedRequest checks the embedding options shared by single and sharded embedding
+func validateEmbedRequest(req *models.EmbedRequest) error {
 	// validate method
 	if !req.Method.IsValid() {
-		return nil, 0, models.ErrInvalidMethod
+		return models.ErrInvalidMethod
 	}
 
 	// validate LSB count for LSB method
 	if req.Method == models.MethodLSB && (req.NLsb < 1 || req.NLsb > 4) {
-		return nil, 0, models.ErrInvalidLSB
+		return models.ErrInvalidLSB
 	}
 
-	cover := make([]byte, len(req.CoverAudio))
-	copy(cover, req.CoverAudio)
+	if req.Method == models.MethodDSSS && !dsssParams(req).IsValid() {
+		return models.ErrInvalidDSSSParams
+	}
+	if req.Method == models.MethodQIM && !models.IsValidQIMStep(qimStep(req)) {
+		return models.ErrInvalidQIMStep
+	}
 
-	// Optional encryption
-	secretToStore := make([]byte, len(secretData))
-	copy(secretToStore, secretData)
-	if req.UseEncryption {
-		if req.StegoKey == "" {
-			return nil, 0, models.ErrInvalidStegoKey
-		}
-		// Add a simple checksum (first 4 bytes of data hash) before encryption for integrity verification
-		checksum := calculateChecksum(secretData)
-		dataWithChecksum := append(checksum[:], secretData...)
-		secretToStore = s.crypto.VigenereCipher(dataWithChecksum, req.StegoKey, true)
+	if !req.ECC.IsValid() {
+		return models.ErrInvalidECCLevel
+	}
+	if !req.ECC.Covers(req.Method.MinECC()) {
+		return models.ErrECCTooLow
 	}
 
-	// Build header+payload:
-	// [magic(8)][method(1)][nLSB(1)][flags(1)][filenameLen(2)][secretLen(4)][filename][metadataLen(2)][metadata][secret bytes]
-	buf := bytes.Buffer{}
-	buf.Write(magicBytes)
+	// Subkeys are derived whenever a stego key is given, the key options need one. Secrets
+	// encrypted to recipients take their encryption key from the recipients instead.
+	if ((req.UseEncryption && len(req.Recipients) == 0) || req.UseRandomStart || req.UseScatter) && req.StegoKey == "" {
+		return models.ErrInvalidStegoKey
+	}
 
-	// Write method type
-	if req.Method == models.MethodLSB {
-		buf.WriteByte(methodLSB)
-	} else {
-		buf.WriteByte(methodParity)
+	if len(req.Recipients) > 255 {
+		return models.ErrInvalidRecipient
+	}
+	for _, recipient := range req.Recipients {
+		if len(recipient) != 32 {
+			return models.ErrInvalidRecipient
+		}
+	}
+	if req.SigningKey != nil && len(req.SigningKey) != 32 {
+		return models.ErrInvalidSigningKey
+	}
+	return nil
+}
+
+// prepareSecret packs and compresses the secret and returns it with the container header describing
+// it. The payload length, cipher id and key check are filled in by embedContainer.
+func prepareSecret(req *models.EmbedRequest, secretData []byte, metadata []byte) (*containerHeader, []byte, error) {
+	// Several secret files are stored back to back, described by a directory in the header
+	var directory []byte
+	if len(req.SecretEntries) > 0 {
+		var err error
+		if secretData, directory, err = packEntries(req.SecretEntries); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	// Write nLSB (only meaningful for LSB method, but always present for format consistency)
+	// Compress before encryption, ciphertext no longer compresses
+	compressed, compressionID := compressSecret(secretData)
+
+	// nLSB is only meaningful for the LSB method, but always present for format consistency.
+	// DSSS and QIM keep the exponent of their chip rate or step in it.
 	nLsb := req.NLsb
-	if req.Method == models.MethodParity {
-		nLsb = 1 // Parity method uses 1 bit per byte
+	switch req.Method {
+	case models.MethodLSB:
+	case models.MethodDSSS:
+		nLsb = log2(dsssParams(req).ChipRate)
+	case models.MethodQIM:
+		nLsb = log2(qimStep(req))
+	default:
+		nLsb = 1 // all other methods use 1 bit per carrier
 	}
-	buf.WriteByte(byte(nLsb))
 
+	keyed := req.StegoKey != ""
+	nsym := req.ECC.ParityBytes()
 	flags := byte(0)
-	if req.UseEncryption {
+	if req.UseEncryption || len(req.Recipients) > 0 {
 		flags |= 1 << 0
 	}
 	if req.UseRandomStart {
 		flags |= 1 << 1
 	}
-	buf.WriteByte(flags)
+	if keyed {
+		flags |= 1 << 4
+	}
+	if req.UseScatter {
+		flags |= 1 << 5
+	}
+	if keyed && !req.PublicHeader {
+		flags |= 1 << 6
+	}
+	if nsym > 0 {
+		flags |= 1 << 7
+	}
 
-	// filename
 	filename := req.SecretFileName
-	if filename == "" {
+	if filename == "" && directory != nil {
+		filename = "secrets"
+	} else if filename == "" {
 		filename = "secret.bin"
 	}
-	if len(filename) > 0xFFFF {
-		return nil, 0, models.ErrFileTooLarge
+
+	// v3 header (fixed fields, filename, TLV metadata, CRC32), followed by the secret
+	header := &containerHeader{
+		method:        methodID(req.Method),
+		nLsb:          nLsb,
+		flags:         flags,
+		filename:      filename,
+		originalSize:  int64(len(secretData)),
+		mimeType:      req.SecretMimeType,
+		createdAt:     time.Now(),
+		compressionID: compressionID,
+		userMetadata:  metadata,
+		directory:     directory,
+	}
+	if nsym > 0 {
+		header.eccParams = []byte{byte(nsym)}
+	}
+	if req.Method == models.MethodDSSS {
+		header.dsssGain = dsssParams(req).Gain
 	}
-	binary.Write(&buf, binary.BigEndian, uint16(len(filename)))
-	binary.Write(&buf, binary.BigEndian, uint32(len(secretToStore)))
-	buf.WriteString(filename)
+	return header, compressed, nil
+}
 
-	// metadata (arbitrary bytes) - allow zero length
-	if metadata == nil {
-		metadata = []byte{}
+// embedContainer encrypts payload if requested, completes header and writes both into req.CoverAudio
+func (s *stegoService) embedContainer(req *models.EmbedRequest, header *containerHeader, payload []byte) ([]byte, models.Distortion, error) {
+	coverAudio, err := s.coverAudio(req)
+	if err != nil {
+		return nil, models.Distortion{}, err
 	}
-	if len(metadata) > 0xFFFF {
-		return nil, 0, models.ErrFileTooLarge
+	cover := make([]byte, len(coverAudio))
+	copy(cover, coverAudio)
+
+	// Subkeys are derived whenever a stego key is given. The salt (and with a public header the KDF
+	// cost) is stored in clear in a preamble so that extraction can derive the same keys.
+	var salt []byte
+	if req.StegoKey != "" {
+		salt = make([]byte, keySaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, models.Distortion{}, err
+		}
 	}
-	binary.Write(&buf, binary.BigEndian, uint16(len(metadata)))
-	if len(metadata) > 0 {
-		buf.Write(metadata)
+	toEmbedBytes, keys, err := s.sealContainer(req, header, payload, salt)
+	if err != nil {
+		return nil, models.Distortion{}, err
 	}
+	preamble := keyPreamble(req, salt)
+	hidden := keys != nil && !req.PublicHeader
 
-	// secret bytes
-	buf.Write(secretToStore)
-	toEmbedBytes := buf.Bytes()
-	toEmbedBits := bytesToBits(toEmbedBytes)
+	// collect payload positions (byte indices in cover: MP3 frame payload or WAV sample LSB bytes)
+	payloadIdxs, err := collectCoverIndices(cover)
+	if err != nil {
+		return nil, models.Distortion{}, err
+	}
+	carrier, err := newCarrier(cover, payloadIdxs, req.Method, header.nLsb, req.StegoKey, dsssParams(req).Gain)
+	if err != nil {
+		return nil, models.Distortion{}, err
+	}
 
-	// collect payload positions (byte indices in cover)
-	payloadIdxs := collectPayloadIndices(cover)
-	if len(payloadIdxs) == 0 {
-		return nil, 0, models.ErrInvalidMP3
+	// Capacity in bits depends on the method: n bits per byte for LSB, 1 bit per carrier otherwise
+	totalCapacityBits := carrier.capacity()
+	preambleBits := len(preamble) * 8
+	if preambleBits+len(toEmbedBytes)*8 > totalCapacityBits {
+		return nil, models.Distortion{}, models.ErrInsufficientCapacity
 	}
 
-	// Calculate capacity based on method
-	var totalCapacityBits int
-	if req.Method == models.MethodLSB {
-		totalCapacityBits = len(payloadIdxs) * req.NLsb
-	} else { // Parity method
-		totalCapacityBits = len(payloadIdxs) // 1 bit per byte
+	// The container follows the key preamble. The position subkey either scatters its bits over the
+	// whole region or, with random start, picks the offset of a contiguous run.
+	layout := bitLayout{regionStart: preambleBits, regionSize: totalCapacityBits - preambleBits}
+	switch {
+	case req.UseScatter:
+		layout.perm = newKeyedPermutation(keys.Position, layout.regionSize)
+	case req.UseRandomStart:
+		layout.start = keyedStartIndex(keys.Position, layout.regionSize)
+	}
+	if hidden {
+		if layout.mask, err = newKeystream(keys.Header); err != nil {
+			return nil, models.Distortion{}, err
+		}
 	}
 
-	if len(toEmbedBits) > totalCapacityBits {
-		return nil, 0, models.ErrInsufficientCapacity
+	// Embed bits sequentially into the carrier slots (wrapping around inside the region)
+	bitLayout{regionStart: 0, regionSize: totalCapacityBits}.writeBytes(carrier, preamble)
+	layout.writeBytes(carrier, toEmbedBytes)
+	flushCarrier(carrier)
+	return s.finishCover(req, coverAudio, cover)
+}
+
+// coverAudio returns the cover of the request, decoded to WAV if req.DecodeToPCM is set or the
+// method is signal-domain, so the payload goes into PCM samples instead of compressed frames
+func (s *stegoService) coverAudio(req *models.EmbedRequest) ([]byte, error) {
+	if req.DecodeToPCM || req.Method.IsSignalDomain() {
+		return s.DecodeToWAV(req.CoverAudio)
 	}
+	return req.CoverAudio, nil
+}
 
-	// determine start bit
-	startBit := 0
-	if req.UseRandomStart {
-		if req.StegoKey == "" {
-			return nil, 0, models.ErrInvalidStegoKey
+// sealContainer derives the subkeys for salt (nil without a stego key), encrypts and signs the
+// payload and returns the complete container with its integrity tag and ECC parity, ready to be
+// written into the carrier, together with the subkeys
+func (s *stegoService) sealContainer(req *models.EmbedRequest, header *containerHeader, payload []byte, salt []byte) ([]byte, *DerivedKeys, error) {
+	var keys *DerivedKeys
+	if salt != nil {
+		params := models.DefaultKDFParams()
+		if req.KDF != nil {
+			params = *req.KDF
+		}
+		derived, err := s.crypto.DeriveKeys(req.StegoKey, salt, params)
+		if err != nil {
+			return nil, nil, err
 		}
-		startBit = deterministicStartIndex(req.StegoKey, totalCapacityBits)
+		keys = derived
+		header.keyCheck = keyCheckValue(keys)
 	}
 
-	// Embed bits using the selected method
-	if req.Method == models.MethodLSB {
-		// LSB embedding - embed bits sequentially into LSBs of payload bytes
-		bitPos := startBit
-		for i := 0; i < len(toEmbedBits); {
-			if bitPos >= totalCapacityBits {
-				// wrap around to beginning (deterministic)
-				bitPos = 0
-			}
-			// find which payload byte and which bit-in-byte slot
-			payloadByteIndex := bitPos / req.NLsb         // which payload byte (index in payloadIdxs)
-			slotIndex := bitPos % req.NLsb                // which LSB slot in that byte (0..n-1)
-			coverBytePos := payloadIdxs[payloadByteIndex] // actual byte index in cover
-			// set or clear that specific LSB slot according to next bit
-			bit := toEmbedBits[i]
-			if bit == 1 {
-				cover[coverBytePos] |= (1 << uint(slotIndex))
-			} else {
-				cover[coverBytePos] &^= (1 << uint(slotIndex))
-			}
-			i++
-			bitPos++
-		}
-	} else { // Parity method
-		// Parity embedding - embed bits by adjusting parity of payload bytes
-		bitPos := startBit
-		for i := 0; i < len(toEmbedBits); {
-			if bitPos >= totalCapacityBits {
-				// wrap around to beginning (deterministic)
-				bitPos = 0
+	// With recipients the payload is encrypted with AES-256-GCM under a random file key, which is
+	// wrapped for every recipient public key in the header
+	payloadKeys, cipherType := keys, req.Cipher
+	if len(req.Recipients) > 0 {
+		fileKey := make([]byte, fileKeySize)
+		if _, err := rand.Read(fileKey); err != nil {
+			return nil, nil, err
+		}
+		header.recipients = make([][]byte, len(req.Recipients))
+		for i, recipient := range req.Recipients {
+			stanza, err := s.crypto.WrapFileKey(fileKey, recipient)
+			if err != nil {
+				return nil, nil, err
 			}
-			coverBytePos := payloadIdxs[bitPos] // direct mapping: bit index to payload byte
-			bit := toEmbedBits[i]
-			cover[coverBytePos] = embedParityBit(cover[coverBytePos], bit)
-			i++
-			bitPos++
+			header.recipients[i] = stanza
+		}
+		derived, err := s.crypto.DeriveFileKeys(fileKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		payloadKeys, cipherType = derived, models.CipherAESGCM
+	}
+
+	// Optional encryption
+	secretToStore := make([]byte, len(payload))
+	copy(secretToStore, payload)
+	header.cipherID = cipherXOR
+	if header.encryptedFlag() {
+		encrypted, id, err := s.encryptSecret(cipherType, payload, payloadKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		secretToStore, header.cipherID = encrypted, id
+	}
+
+	// A signed container records the signer public key in its header
+	if req.SigningKey != nil {
+		signer, err := s.crypto.SignerPublicKey(req.SigningKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		header.signer = signer
+	}
+
+	// Build header+payload, followed by the signature over both and the integrity tag over all of
+	// them, keyed by the stego key or else the file key
+	header.payloadLen = len(secretToStore)
+	headerBytes, err := header.encode()
+	if err != nil {
+		return nil, nil, err
+	}
+	tagKeys := keys
+	if tagKeys == nil {
+		tagKeys = payloadKeys
+	}
+	container := append(headerBytes, secretToStore...)
+	if req.SigningKey != nil {
+		signature, err := s.crypto.Sign(container, req.SigningKey)
+		if err != nil {
+			return nil, nil, err
 		}
+		container = append(container, signature...)
 	}
+	container = append(container, integrityTag(tagKeys, container)...)
 
-	// calculate PSNR using audio service
-	psnr := s.audio.CalculatePSNR(req.CoverAudio, cover)
+	// Optional forward error correction of the whole container
+	if nsym := req.ECC.ParityBytes(); nsym > 0 {
+		container = eccEncode(container, nsym)
+	}
+	return container, keys, nil
+}
 
-	return cover, psnr, nil
+// keyPreamble returns the key preamble written before the container, nil without a salt. With ECC
+// the preamble is protected by Reed–Solomon parity as well.
+func keyPreamble(req *models.EmbedRequest, salt []byte) []byte {
+	if salt == nil {
+		return nil
+	}
+	preamble := salt
+	if req.PublicHeader {
+		params := models.DefaultKDFParams()
+		if req.KDF != nil {
+			params = *req.KDF
+		}
+		preamble = encodeKeyPreamble(params, salt)
+	}
+	if req.ECC.ParityBytes() > 0 {
+		preamble = rsEncode(preamble, preambleParity)
+	}
+	return preamble
+}
+
+// finishCover completes a modified cover and measures its distortion against the original
+func (s *stegoService) finishCover(req *models.EmbedRequest, coverAudio []byte, cover []byte) ([]byte, models.Distortion, error) {
+	// Side information changed, so protected frames need a fresh CRC
+	if req.Method == models.MethodBitstream {
+		updateFrameCRCs(cover)
+	}
+
+	// calculate PSNR and SNR using audio service (over the sample data only for WAV covers)
+	original, modified := pcmRegion(coverAudio), pcmRegion(cover)
+	distortion := models.Distortion{
+		PSNR: s.audio.CalculatePSNR(original, modified),
+		SNR:  s.audio.CalculateSNR(original, modified),
+	}
+
+	return cover, distortion, nil
 }
 
 // ExtractMessage extracts embedded data from audioData using method and parameters stored in header.
 // If req.StegoKey is required to decrypt, it will be used.
 func (s *stegoService) ExtractMessage(req *models.ExtractRequest, audioData []byte) ([]byte, string, error) {
+	result, err := s.ExtractContainer(req, audioData)
+	if err != nil {
+		return nil, "", err
+	}
+	return result.SecretData, result.Filename, nil
+}
+
+// ExtractContainer extracts embedded data like ExtractMessage and also returns the metadata recorded
+// in the container header (MIME type, original size, embedding time and format version).
+func (s *stegoService) ExtractContainer(req *models.ExtractRequest, audioData []byte) (*models.ExtractResponse, error) {
+	c, err := s.extractContainer(req, audioData)
+	if err != nil {
+		return nil, err
+	}
+	if c.header.shard != nil {
+		return nil, models.ErrShardedSecret
+	}
+	if c.header.share != nil {
+		return nil, models.ErrSecretShare
+	}
+	result, err := finishExtraction(c.header, c.payload, c.version)
+	if err != nil {
+		return nil, err
+	}
+	result.Signature = c.signature
+	return result, nil
+}
+
+// extractedContainer is a container read from a stego file: its header and the decrypted payload,
+// which is still compressed and, for shards and shares, only one part of the secret
+type extractedContainer struct {
+	header    *containerHeader
+	payload   []byte
+	version   int
+	signature models.SignatureInfo
+}
+
+// extractContainer finds and reads the container in audioData, trying every method and location
+func (s *stegoService) extractContainer(req *models.ExtractRequest, audioData []byte) (*extractedContainer, error) {
 	if len(audioData) == 0 {
-		return nil, "", models.ErrInvalidMP3
+		return nil, models.ErrInvalidMP3
 	}
 	cover := audioData
-	payloadIdxs := collectPayloadIndices(cover)
-	if len(payloadIdxs) == 0 {
-		return nil, "", models.ErrInvalidMP3
+	payloadIdxs, err := collectCoverIndices(cover)
+	if err != nil {
+		return nil, err
 	}
 
-	// Try both methods if not specified, or use specified method
-	methodsToTry := []int{methodLSB, methodParity}
+	// Try every method if not specified, or use specified method
+	methodsToTry := models.GetSupportedMethods()
 	if req.Method.IsValid() {
-		if req.Method == models.MethodLSB {
-			methodsToTry = []int{methodLSB}
-		} else {
-			methodsToTry = []int{methodParity}
-		}
+		methodsToTry = []models.SteganographyMethod{req.Method}
 	}
 
+	// A container that was found but could not be read (wrong key, corrupted header) is reported
+	// instead of the generic failure once all methods have been tried
+	var foundErr error
+	var decoded []byte // MP3 input decoded once for the signal-domain methods
+	derived := keyCache{}
+	var legacyIdxs []int
+	if !isWAVData(cover) {
+		legacyIdxs = collectLegacyPayloadIndices(cover)
+	}
 	for _, method := range methodsToTry {
-		var result []byte
-		var filename string
-		var err error
+		// LSB matching reads exactly like 1-bit LSB, whose pass already accepts its containers
+		if method == models.MethodLSBMatching && len(methodsToTry) > 1 {
+			continue
+		}
+		methodCover := cover
+		if method.IsSignalDomain() {
+			if decoded == nil {
+				if decoded, err = s.DecodeToWAV(cover); err != nil {
+					continue
+				}
+			}
+			methodCover = decoded
+		}
+		// LSB may have used any of n = 1..4 and QIM any step, the other methods always use one
+		// bit per carrier and DSSS the chip rate of its probe, from wherever the probe was found.
+		// Each candidate reads only the header bits until one validates, so the accepted ranges
+		// bound what a miss costs.
+		nValues := []int{1}
+		dsssOffset := 0
+		switch method {
+		case models.MethodLSB:
+			nValues = []int{1, 2, 3, 4}
+		case models.MethodDSSS:
+			nValues = nil
+			if n, offset, ok := readDSSSProbe(methodCover, req.StegoKey); ok {
+				nValues, dsssOffset = []int{n}, offset
+			}
+		case models.MethodQIM:
+			nValues = exponents(models.GetQIMSteps())
+		}
+		for _, n := range nValues {
+			carrier, err := newCarrier(methodCover, payloadIdxs, method, n, req.StegoKey, 0)
+			if err != nil {
+				continue
+			}
+			if c, ok := carrier.(*dsssCarrier); ok {
+				c.offset = dsssOffset
+			}
+			result, err := s.tryExtractFromBits(req, newLazyBits(carrier), carrier.capacity(), methodID(method), n, derived)
+			if err == nil && result != nil {
+				return result, nil
+			}
+			if err != models.ErrExtractionFailed && foundErr == nil {
+				foundErr = err
+			}
+			// MP3 files from versions that also embedded into side info and VBR tag frames
+			if legacyIdxs != nil && (method == models.MethodLSB || method == models.MethodParity) {
+				result, err := s.extractLegacyFrames(req, cover, legacyIdxs, method, n)
+				if err == nil {
+					return result, nil
+				}
+				if err != models.ErrExtractionFailed && foundErr == nil {
+					foundErr = err
+				}
+			}
+		}
+	}
 
-		if method == methodLSB {
-			result, filename, err = s.extractLSBMethod(req, cover, payloadIdxs)
-		} else {
-			result, filename, err = s.extractParityMethod(req, cover, payloadIdxs)
+	if foundErr != nil {
+		return nil, foundErr
+	}
+	return nil, models.ErrExtractionFailed
+}
+
+// extractLegacyFrames looks for a container on the MP3 index set of collectLegacyPayloadIndices.
+// Only v2 headers were written there, at slot 0 or at the start derived from the stego key.
+func (s *stegoService) extractLegacyFrames(req *models.ExtractRequest, cover []byte, indices []int, method models.SteganographyMethod, n int) (*extractedContainer, error) {
+	carrier, err := newCarrier(cover, indices, method, n, req.StegoKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	bits, totalBits := newLazyBits(carrier), carrier.capacity()
+	starts := []int{0}
+	if req.StegoKey != "" {
+		starts = append(starts, deterministicStartIndex(req.StegoKey, totalBits))
+	}
+	firstErr := models.ErrExtractionFailed
+	for _, start := range starts {
+		layout := bitLayout{regionSize: totalBits, start: start}
+		result, err := s.parseLegacyContainer(req, bits, layout, nil, methodID(method), n)
+		if err == nil {
+			return result, nil
+		}
+		if firstErr == models.ErrExtractionFailed {
+			firstErr = err
 		}
+	}
+	return nil, firstErr
+}
+
+// containerLocation describes where and how a container may be stored in the carrier bits
+type containerLocation struct {
+	layout bitLayout
+	keys   *DerivedKeys // subkeys derived from the preamble, nil for containers without one
+	nsym   int          // Reed–Solomon parity bytes per block, 0 without ECC
+}
 
-		if err == nil && result != nil {
-			return result, filename, nil
+// source returns the reader for the container bytes at this location
+func (loc containerLocation) source(bits bitReader) byteSource {
+	var src byteSource = layoutSource{bits: bits, layout: loc.layout}
+	if loc.nsym > 0 {
+		src = newECCSource(src, loc.nsym)
+	}
+	return src
+}
+
+// tryExtractFromBits attempts to extract data from the totalBits slots of a carrier
+func (s *stegoService) tryExtractFromBits(req *models.ExtractRequest, bits bitReader, totalBits int, expectedMethod int, expectedN int, derived keyCache) (*extractedContainer, error) {
+	// A damaged header read without ECC may belong to an ECC container tried later, so errors are
+	// only reported once every location has failed
+	firstErr := models.ErrExtractionFailed
+	for _, loc := range s.containerLocations(req, bits, totalBits, derived) {
+		result, err := s.parseContainer(req, bits, loc, expectedMethod, expectedN)
+		if err == nil {
+			return result, nil
+		}
+		if firstErr == models.ErrExtractionFailed {
+			firstErr = err
 		}
 	}
 
-	return nil, "", models.ErrExtractionFailed
+	return nil, firstErr
+}
+
+// keyCache holds the subkeys derived during one extraction by salt and KDF cost, nil where the
+// derivation failed. Carriers that read the same preamble share one Argon2id run.
+type keyCache map[string]*DerivedKeys
+
+// deriveKeys returns the subkeys of stegoKey for salt and params, deriving them on first use
+func (s *stegoService) deriveKeys(cache keyCache, stegoKey string, salt []byte, params models.KDFParams) *DerivedKeys {
+	id := fmt.Sprintf("%x/%d/%d/%d", salt, params.Time, params.MemoryMiB, params.Threads)
+	if keys, ok := cache[id]; ok {
+		return keys
+	}
+	keys, err := s.crypto.DeriveKeys(stegoKey, salt, params)
+	if err != nil {
+		keys = nil
+	}
+	cache[id] = keys
+	return keys
 }
 
-// extractLSBMethod extracts data using LSB method (tries different n values)
-func (s *stegoService) extractLSBMethod(req *models.ExtractRequest, cover []byte, payloadIdxs []int) ([]byte, string, error) {
-	// Try n = 1..4 LSBs since we don't know which was used
-	for n := 1; n <= 4; n++ {
-		totalBits := len(payloadIdxs) * n
-		bits := make([]uint8, 0, totalBits)
-		// get linear bit sequence in LSB order (slot 0..n-1 per payload byte)
-		for _, idx := range payloadIdxs {
-			for slot := 0; slot < n; slot++ {
-				bits = append(bits, (cover[idx]>>uint(slot))&1)
+// containerLocations lists every place a container may start in the bit stream, in the order
+// they are tried. Keys are derived once per distinct salt and KDF cost and kept in derived.
+func (s *stegoService) containerLocations(req *models.ExtractRequest, bits bitReader, totalBits int, derived keyCache) []containerLocation {
+	eccParities := []int{0}
+	for _, level := range models.GetECCLevels() {
+		eccParities = append(eccParities, level.ParityBytes())
+	}
+
+	// Containers without a key preamble start at slot 0, with or without ECC
+	var locs []containerLocation
+	for _, nsym := range eccParities {
+		locs = append(locs, containerLocation{layout: bitLayout{regionSize: totalBits}, nsym: nsym})
+	}
+	if req.StegoKey == "" {
+		return locs
+	}
+
+	// Files from older versions: container at the legacy key-derived start
+	locs = append(locs, containerLocation{layout: bitLayout{regionSize: totalBits, start: deterministicStartIndex(req.StegoKey, totalBits)}})
+
+	addKeyed := func(preambleSize int, protected bool, keys *DerivedKeys, mask *keystream) {
+		nsyms := []int{0}
+		if protected {
+			nsyms = eccParities[1:] // an ECC-protected preamble is only written for ECC containers
+		}
+		for _, layout := range keyedLayouts(preambleSize*8, totalBits, keys, mask) {
+			for _, nsym := range nsyms {
+				locs = append(locs, containerLocation{layout: layout, keys: keys, nsym: nsym})
 			}
 		}
+	}
 
-		result, filename, err := s.tryExtractFromBits(req, bits, totalBits, methodLSB, n)
-		if err == nil {
-			return result, filename, nil
+	// Current files: derive the subkeys from the preamble, container right after it, at the keyed
+	// start or scattered along the keyed permutation. A public preamble carries the KDF cost,
+	// a hidden one only the salt, so the cost comes from the request.
+	hiddenParams := models.DefaultKDFParams()
+	if req.KDF != nil {
+		hiddenParams = *req.KDF
+	}
+	for _, protected := range []bool{false, true} {
+		if raw, size := readPreamble(bits, totalBits, keyPreambleSize, protected); raw != nil {
+			if params, salt, ok := decodeKeyPreamble(raw); ok {
+				if keys := s.deriveKeys(derived, req.StegoKey, salt, params); keys != nil {
+					addKeyed(size, protected, keys, nil)
+				}
+			}
+		}
+		if salt, size := readPreamble(bits, totalBits, hiddenPreambleSize, protected); salt != nil {
+			if keys := s.deriveKeys(derived, req.StegoKey, salt, hiddenParams); keys != nil {
+				if mask, err := newKeystream(keys.Header); err == nil {
+					addKeyed(size, protected, keys, mask)
+				}
+			}
 		}
 	}
-	return nil, "", models.ErrExtractionFailed
+	return locs
 }
 
-// extractParityMethod extracts data using Parity method
-func (s *stegoService) extractParityMethod(req *models.ExtractRequest, cover []byte, payloadIdxs []int) ([]byte, string, error) {
-	totalBits := len(payloadIdxs) // 1 bit per byte for parity
-	bits := make([]uint8, 0, totalBits)
-
-	// Extract parity bits from each payload byte
-	for _, idx := range payloadIdxs {
-		bit := extractParityBit(cover[idx])
-		bits = append(bits, bit)
+// keyedLayouts returns the layouts a keyed container may use after a preamble of preambleBits:
+// sequential, at the keyed start offset and scattered along the keyed permutation, and with a
+// hidden header scattered over either layer of a deniable embedding
+func keyedLayouts(preambleBits, totalBits int, keys *DerivedKeys, mask *keystream) []bitLayout {
+	region := totalBits - preambleBits
+	if region <= 0 {
+		return nil
+	}
+	layouts := []bitLayout{
+		{regionStart: preambleBits, regionSize: region, mask: mask},
+		{regionStart: preambleBits, regionSize: region, start: keyedStartIndex(keys.Position, region), mask: mask},
+		{regionStart: preambleBits, regionSize: region, perm: newKeyedPermutation(keys.Position, region), mask: mask},
 	}
+	if mask != nil && region >= deniableLayers {
+		for layer := range deniableLayers {
+			layouts = append(layouts, layerLayout(preambleBits, totalBits, layer, keys, mask))
+		}
+	}
+	return layouts
+}
 
-	return s.tryExtractFromBits(req, bits, totalBits, methodParity, 1)
+// readPreamble reads a key preamble of n bytes from the first carrier slots. A protected preamble
+// is followed by preambleParity Reed–Solomon parity bytes and is corrected before use.
+// Returns the preamble and the number of bytes it occupies, or nil if it cannot be read.
+func readPreamble(bits bitReader, totalBits, n int, protected bool) ([]byte, int) {
+	size := n
+	if protected {
+		size += preambleParity
+	}
+	raw := bitLayout{regionSize: totalBits}.readBytes(bits, 0, size)
+	if raw == nil {
+		return nil, 0
+	}
+	if protected {
+		corrected, err := rsDecode(raw, preambleParity)
+		if err != nil {
+			return nil, 0
+		}
+		raw = corrected
+	}
+	return raw, size
 }
 
-// tryExtractFromBits attempts to extract data from a bit stream
-func (s *stegoService) tryExtractFromBits(req *models.ExtractRequest, bits []uint8, totalBits int, expectedMethod int, expectedN int) ([]byte, string, error) {
-	// Try possible random start positions
-	tryStarts := []int{0}
-	if req.StegoKey != "" {
-		start := deterministicStartIndex(req.StegoKey, totalBits)
-		tryStarts = append(tryStarts, start)
+// parseContainer reads and validates the header at the given location and returns the container.
+// Both v3 containers and legacy v2 headers are accepted.
+// Returns ErrExtractionFailed if there is no container at this location.
+func (s *stegoService) parseContainer(req *models.ExtractRequest, bits bitReader, loc containerLocation, expectedMethod int, expectedN int) (*extractedContainer, error) {
+	layout, keys := loc.layout, loc.keys
+	if loc.nsym == 0 {
+		if magic := layout.readBytes(bits, 0, len(magicV2)); magic != nil && bytes.Equal(magic, magicV2) {
+			return s.parseLegacyContainer(req, bits, layout, keys, expectedMethod, expectedN)
+		}
+	}
+
+	src := loc.source(bits)
+	header, payloadOffset, err := readContainerHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// verify method and n match expected values, and that the location matches the KDF, scatter,
+	// hidden and ECC flags
+	if !sameReadout(header.method, expectedMethod) || header.nLsb != expectedN {
+		return nil, models.ErrExtractionFailed
+	}
+	if (header.flags&(1<<4) != 0) != (keys != nil) || (header.flags&(1<<5) != 0) != (layout.perm != nil) ||
+		(header.flags&(1<<6) != 0) != (layout.mask != nil) || (header.flags&(1<<7) != 0) != (loc.nsym > 0) {
+		return nil, models.ErrExtractionFailed
+	}
+	if loc.nsym > 0 && !bytes.Equal(header.eccParams, []byte{byte(loc.nsym)}) {
+		return nil, models.ErrExtractionFailed
 	}
 
-	for _, start := range tryStarts {
-		// rotate bits so that start becomes 0
-		rot := make([]uint8, len(bits))
-		for i := 0; i < len(bits); i++ {
-			rot[i] = bits[(start+i)%len(bits)]
+	// a wrong key is reported before the tag, which would fail as well
+	if keys != nil && !hmac.Equal(header.keyCheck, keyCheckValue(keys)) {
+		return nil, models.ErrInvalidStegoKey
+	}
+
+	// a secret encrypted to recipients needs the file key from one of the provided private keys
+	payloadKeys := keys
+	if len(header.recipients) > 0 {
+		fileKey := s.unwrapFileKey(header.recipients, req.Identities)
+		if fileKey == nil {
+			return nil, models.ErrNoMatchingIdentity
 		}
-		// convert first bytes enough to check magic and header sizes
-		raw := bitsToBytes(rot)
-		// need at least header length: magic(8)+method(1)+nLSB(1)+flags(1)+filenameLen(2)+secretLen(4) = 17 bytes
-		if len(raw) < 17 {
-			continue
+		derived, err := s.crypto.DeriveFileKeys(fileKey)
+		if err != nil {
+			return nil, err
 		}
-		if !bytes.Equal(raw[0:8], magicBytes) {
-			continue
+		payloadKeys = derived
+	}
+	tagKeys := keys
+	if tagKeys == nil {
+		tagKeys = payloadKeys
+	}
+
+	// header and payload followed by the optional signature and the integrity tag
+	signedLen := payloadOffset + header.payloadLen
+	body := src.readAt(0, signedLen+header.signatureLen()+integrityTagSize)
+	if body == nil {
+		return nil, models.ErrCorruptedData
+	}
+	data, tag := body[:len(body)-integrityTagSize], body[len(body)-integrityTagSize:]
+	if !hmac.Equal(tag, integrityTag(tagKeys, data)) {
+		return nil, models.ErrIntegrityFailed
+	}
+	signature := s.checkSignature(req, header, data[:signedLen], data[signedLen:])
+	secretBytes := data[payloadOffset:signedLen]
+
+	// If encryption flag set, and key provided, decrypt with the cipher recorded in the TLV block
+	if header.encryptedFlag() {
+		if payloadKeys == nil && req.StegoKey == "" {
+			return nil, models.ErrInvalidStegoKey
+		}
+		decrypted, err := s.decryptSecret(header.cipherID, secretBytes, req.StegoKey, payloadKeys)
+		if err != nil {
+			return nil, err
 		}
+		secretBytes = decrypted
+	}
+	return &extractedContainer{header: header, payload: secretBytes, version: containerVersion, signature: signature}, nil
+}
 
-		embeddedMethod := int(raw[8])
-		embeddedN := int(raw[9])
-		flags := raw[10]
+// sameReadout reports whether a container written with method is read by the carrier of expected.
+// LSB matching and LSB only differ in how bits are written.
+func sameReadout(method, expected int) bool {
+	lsbFamily := func(m int) bool { return m == methodLSB || m == methodLSBMatching }
+	return method == expected || (lsbFamily(method) && lsbFamily(expected))
+}
 
-		// verify method and n match expected values
-		if embeddedMethod != expectedMethod || embeddedN != expectedN {
-			continue
+// finishExtraction decompresses the payload, splits multi-file payloads along their directory and
+// returns the secret together with the metadata recorded in the header
+func finishExtraction(header *containerHeader, payload []byte, version int) (*models.ExtractResponse, error) {
+	secretBytes, err := decompressSecret(header.compressionID, payload, header.originalSize)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.SecretEntry
+	if len(header.directory) > 0 {
+		if entries, err = unpackEntries(header.directory, secretBytes); err != nil {
+			return nil, err
 		}
+	}
 
-		// read filename len and secret len
-		filenameLen := int(binary.BigEndian.Uint16(raw[11:13]))
-		secretLen := int(binary.BigEndian.Uint32(raw[13:17]))
-		// check lengths sanity
-		headerTotal := 8 + 1 + 1 + 1 + 2 + 4 + filenameLen + 2 // magic+method+nLSB+flags+filenameLen+secretLen+filename+metadataLen
-		// need to ensure we extracted enough bytes to read metadataLen too
-		if len(raw) < headerTotal {
-			// insufficient raw, continue
-			continue
+	result := &models.ExtractResponse{
+		SecretData:    secretBytes,
+		Filename:      header.filename,
+		FileSize:      len(secretBytes),
+		ExtractionOK:  true,
+		MimeType:      header.mimeType,
+		OriginalSize:  header.originalSize,
+		FormatVersion: version,
+		Entries:       entries,
+	}
+	if !header.createdAt.IsZero() {
+		result.EmbeddedAt = &header.createdAt
+	}
+	switch header.method {
+	case methodDSSS:
+		result.ChipRate, result.Gain = 1<<header.nLsb, header.dsssGain
+	case methodQIM:
+		result.QIMStep = 1 << header.nLsb
+	}
+	return result, nil
+}
+
+// parseLegacyContainer reads a v2 header ("ASTEGv2" magic) and returns the secret
+func (s *stegoService) parseLegacyContainer(req *models.ExtractRequest, bits bitReader, layout bitLayout, keys *DerivedKeys, expectedMethod int, expectedN int) (*extractedContainer, error) {
+	// need at least header length: magic(8)+method(1)+nLSB(1)+flags(1)+filenameLen(2)+secretLen(4) = 17 bytes
+	raw := layout.readBytes(bits, 0, 17)
+	if raw == nil || !bytes.Equal(raw[0:8], magicV2) {
+		return nil, models.ErrExtractionFailed
+	}
+
+	embeddedMethod := int(raw[8])
+	embeddedN := int(raw[9])
+	flags := raw[10]
+
+	// verify method and n match expected values, and that the key preamble matches the KDF flag
+	if embeddedMethod != expectedMethod || embeddedN != expectedN {
+		return nil, models.ErrExtractionFailed
+	}
+	if (flags&(1<<4) != 0) != (keys != nil) || (flags&(1<<5) != 0) != (layout.perm != nil) {
+		return nil, models.ErrExtractionFailed
+	}
+
+	// read filename len and secret len
+	filenameLen := int(binary.BigEndian.Uint16(raw[11:13]))
+	secretLen := int(binary.BigEndian.Uint32(raw[13:17]))
+
+	// filename followed by metadataLen
+	rest := layout.readBytes(bits, 17, filenameLen+2)
+	if rest == nil {
+		return nil, models.ErrExtractionFailed
+	}
+	filename := string(rest[:filenameLen])
+	metadataLen := int(binary.BigEndian.Uint16(rest[filenameLen:]))
+
+	// metadata followed by the secret; if the lengths exceed the capacity this is not a container
+	body := layout.readBytes(bits, 17+filenameLen+2, metadataLen+secretLen)
+	if body == nil {
+		return nil, models.ErrExtractionFailed
+	}
+	secretBytes := body[metadataLen:]
+
+	// If encryption flag set, and key provided, decrypt with the cipher recorded in the flags
+	encFlag := (flags & (1 << 0)) != 0
+	if encFlag {
+		if req.StegoKey == "" {
+			return nil, models.ErrInvalidStegoKey
 		}
-		filenameStart := 17
-		if filenameLen > 0 {
-			if len(raw) < filenameStart+filenameLen+2 {
-				continue
-			}
+		decrypted, err := s.decryptSecret(int(flags>>2)&0x03, secretBytes, req.StegoKey, keys)
+		if err != nil {
+			return nil, err
 		}
-		filename := string(raw[17 : 17+filenameLen])
-		metaLenOff := 17 + filenameLen
-		metadataLen := int(binary.BigEndian.Uint16(raw[metaLenOff : metaLenOff+2]))
-		metaStart := metaLenOff + 2
-		if len(raw) < metaStart+metadataLen+secretLen {
-			// maybe we didn't extract whole payload yet; but if not enough capacity, skip
-			// However we only need to return the secret if lengths valid
-			// continue to next attempt
-			continue
+		secretBytes = decrypted
+	}
+	// success; v2 headers only record the filename
+	return &extractedContainer{
+		header:    &containerHeader{filename: filename},
+		payload:   secretBytes,
+		version:   2,
+		signature: models.SignatureInfo{Status: models.SignatureUnsigned},
+	}, nil
+}
+
+// encryptSecret encrypts the secret with the selected cipher and returns the cipher id for the header.
+// Vigenère has no integrity protection of its own, so a 4-byte check value keyed with the integrity
+// subkey is encrypted along with the data.
+func (s *stegoService) encryptSecret(cipherType models.CipherType, secretData []byte, keys *DerivedKeys) ([]byte, int, error) {
+	switch cipherType {
+	case models.CipherAESGCM:
+		encrypted, err := s.crypto.AESGCMEncrypt(secretData, keys.Encryption)
+		if err != nil {
+			return nil, 0, err
 		}
-		secretStart := metaStart + metadataLen
-		secretBytes := raw[secretStart : secretStart+secretLen]
-		// If encryption flag set, and key provided, decrypt
-		encFlag := (flags & (1 << 0)) != 0
-		if encFlag {
-			if req.StegoKey == "" {
-				return nil, "", models.ErrInvalidStegoKey
-			}
-			decrypted := s.crypto.VigenereCipher(secretBytes, req.StegoKey, false)
+		return encrypted, cipherAESGCM, nil
+	case models.CipherVigenere, "":
+		checksum := keyedChecksum(keys.Integrity, secretData)
+		dataWithChecksum := append(checksum[:], secretData...)
+		return s.crypto.VigenereCipher(dataWithChecksum, string(keys.Encryption), true), cipherVigenere, nil
+	default:
+		return nil, 0, models.ErrInvalidCipher
+	}
+}
 
-			// Validate checksum (first 4 bytes)
-			if len(decrypted) < 4 {
-				return nil, "", models.ErrInvalidStegoKey
-			}
+// encryptionOverhead returns how many bytes encryptSecret adds to the secret for the request's cipher
+func encryptionOverhead(req *models.EmbedRequest) int {
+	switch {
+	case len(req.Recipients) > 0:
+		return 12 + 16 // always AES-256-GCM
+	case !req.UseEncryption:
+		return 0
+	case req.Cipher == models.CipherAESGCM:
+		return 12 + 16 // GCM nonce and authentication tag
+	default:
+		return 4 // Vigenère check value
+	}
+}
 
-			actualData := decrypted[4:]
-			expectedChecksum := calculateChecksum(actualData)
+// checkSignature verifies the sender signature of a container over its header and payload and
+// tells whether the signer is one of the trusted signers of the request
+func (s *stegoService) checkSignature(req *models.ExtractRequest, header *containerHeader, signed []byte, signature []byte) models.SignatureInfo {
+	if len(header.signer) == 0 {
+		return models.SignatureInfo{Status: models.SignatureUnsigned}
+	}
+	info := models.SignatureInfo{Status: models.SignatureInvalid, Signer: formatSignerKey(header.signer)}
+	if !s.crypto.Verify(signed, signature, header.signer) {
+		return info
+	}
+	info.Status = models.SignatureUntrusted
+	for _, trusted := range req.TrustedSigners {
+		if bytes.Equal(trusted, header.signer) {
+			info.Status = models.SignatureVerified
+		}
+	}
+	return info
+}
 
-			// Compare checksums
-			for i := 0; i < 4; i++ {
-				if decrypted[i] != expectedChecksum[i] {
-					return nil, "", models.ErrInvalidStegoKey
-				}
+// unwrapFileKey returns the file key from the first stanza one of the identities can open, or nil
+func (s *stegoService) unwrapFileKey(stanzas [][]byte, identities [][]byte) []byte {
+	for _, identity := range identities {
+		for _, stanza := range stanzas {
+			if fileKey, err := s.crypto.UnwrapFileKey(stanza, identity); err == nil {
+				return fileKey
 			}
+		}
+	}
+	return nil
+}
 
-			secretBytes = actualData
+// decryptSecret reverses encryptSecret for the cipher id stored in the header.
+// keys is nil for stego files from older versions, which used the stego key directly.
+func (s *stegoService) decryptSecret(cipherID int, secretBytes []byte, stegoKey string, keys *DerivedKeys) ([]byte, error) {
+	var decrypted []byte
+	switch {
+	case cipherID == cipherAESGCM:
+		var aesKey []byte
+		if keys != nil {
+			aesKey = keys.Encryption
+		} else {
+			legacyKey := sha256.Sum256([]byte(stegoKey))
+			aesKey = legacyKey[:]
 		}
-		// success
-		return secretBytes, filename, nil
+		plain, err := s.crypto.AESGCMDecrypt(secretBytes, aesKey)
+		if err != nil {
+			return nil, models.ErrInvalidStegoKey
+		}
+		return plain, nil
+	case cipherID == cipherVigenere && keys != nil:
+		decrypted = s.crypto.VigenereCipher(secretBytes, string(keys.Encryption), false)
+	case cipherID == cipherVigenere:
+		decrypted = s.crypto.VigenereCipher(secretBytes, stegoKey, false)
+	case cipherID == cipherXOR:
+		decrypted = s.crypto.XORCipher(secretBytes, stegoKey)
+	default:
+		return nil, models.ErrCorruptedData
 	}
 
-	return nil, "", models.ErrExtractionFailed
+	// Validate checksum (first 4 bytes)
+	if len(decrypted) < 4 {
+		return nil, models.ErrInvalidStegoKey
+	}
+	actualData := decrypted[4:]
+	expectedChecksum := calculateChecksum(actualData)
+	if keys != nil {
+		expectedChecksum = keyedChecksum(keys.Integrity, actualData)
+	}
+	for i := 0; i < 4; i++ {
+		if decrypted[i] != expectedChecksum[i] {
+			return nil, models.ErrInvalidStegoKey
+		}
+	}
+	return actualData, nil
 }
@@ -0,0 +1,465 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	mathrand "math/rand"
+	"os"
+	"testing"
+
+	"github.com/Nerggg/Audio-Steganography-LSB/backend/models"
+)
+
+// legacySecret is the secret embedded in the stego files of testdata written by older versions
+const legacySecret = "hidden by an older version\n"
+
+func newTestStegoService() *stegoService {
+	return NewStegoService(NewCryptographyService(), NewAudioService(), NewAudioEncoder()).(*stegoService)
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// v2_lsb2.mp3 was embedded with 2-bit LSB by the version that walked every byte after the frame
+// header, side info and the Xing frame included
+func TestExtractLegacyMP3Frames(t *testing.T) {
+	stego := readTestdata(t, "v2_lsb2.mp3")
+	for _, method := range []models.SteganographyMethod{"", models.MethodLSB} {
+		result, err := newTestStegoService().ExtractContainer(&models.ExtractRequest{Method: method}, stego)
+		if err != nil {
+			t.Fatalf("method %q: %v", method, err)
+		}
+		if string(result.SecretData) != legacySecret || result.Filename != "note.txt" || result.FormatVersion != 2 {
+			t.Fatalf("method %q: got %q in %q, version %d", method, result.SecretData, result.Filename, result.FormatVersion)
+		}
+	}
+}
+
+// The v2 files of testdata were written by older versions: v2_parity_key.mp3 with parity, the XOR
+// cipher and the random start derived from the stego key over the old frame walker, and
+// v2_lsb_scatter_kdf.mp3 with Vigenère, scatter and a key preamble after the KDF was introduced
+func TestExtractV2Header(t *testing.T) {
+	for _, name := range []string{"v2_parity_key.mp3", "v2_lsb_scatter_kdf.mp3"} {
+		stego := readTestdata(t, name)
+		result, err := newTestStegoService().ExtractContainer(&models.ExtractRequest{StegoKey: "legacy key"}, stego)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(result.SecretData) != legacySecret || result.Filename != "note.txt" || result.FormatVersion != 2 {
+			t.Fatalf("%s: got %q in %q, version %d", name, result.SecretData, result.Filename, result.FormatVersion)
+		}
+
+		if _, err := newTestStegoService().ExtractContainer(&models.ExtractRequest{StegoKey: "other key"}, stego); err == nil {
+			t.Fatalf("%s: extracted with the wrong key", name)
+		}
+	}
+}
+
+// testKDF keeps key derivation cheap in tests
+var testKDF = &models.KDFParams{Time: 1, MemoryMiB: 8, Threads: 1}
+
+// testWAV returns a 16-bit 44.1 kHz WAV file of frames samples per channel holding a few tones over
+// low-passed noise, loud enough for the signal-domain methods to hide bits in
+func testWAV(frames, channels int) []byte {
+	rng := mathrand.New(mathrand.NewSource(1))
+	samples := make([]int16, frames*channels)
+	noise := make([]float64, channels)
+	for i := 0; i < frames; i++ {
+		t := float64(i) / 44100
+		for ch := range noise {
+			noise[ch] = 0.9*noise[ch] + 0.1*rng.NormFloat64()*6000
+			v := 3000*math.Sin(2*math.Pi*220*t) + 1500*math.Sin(2*math.Pi*1375*t+float64(ch)) + noise[ch]
+			samples[i*channels+ch] = int16(v)
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+2*len(samples)))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(channels), uint32(44100), uint32(44100 * 2 * channels), uint16(2 * channels), uint16(16)} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(2*len(samples)))
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+// testRoundTrip embeds secret with req, checks that it is read back with and without naming the
+// method, and returns the stego file with its distortion
+func testRoundTrip(t *testing.T, req models.EmbedRequest, secret []byte) ([]byte, models.Distortion) {
+	t.Helper()
+	s := newTestStegoService()
+	stego, distortion, err := s.EmbedMessage(&req, secret, nil)
+	if err != nil {
+		t.Fatalf("embed: %v", err)
+	}
+	for _, method := range []models.SteganographyMethod{req.Method, ""} {
+		result, err := s.ExtractContainer(&models.ExtractRequest{StegoKey: req.StegoKey, KDF: req.KDF, Method: method}, stego)
+		if err != nil {
+			t.Fatalf("extract with method %q: %v", method, err)
+		}
+		if !bytes.Equal(result.SecretData, secret) {
+			t.Fatalf("extract with method %q: secret differs", method)
+		}
+	}
+	return stego, distortion
+}
+
+// The signal-domain methods read back with and without naming them, above a PSNR floor, and find
+// nothing under another key or in the untouched cover. Phase coding rotates every segment after
+// the first loud one, which moves the waveform far more than it changes the sound.
+func TestSignalMethods(t *testing.T) {
+	for _, tc := range []struct {
+		req              models.EmbedRequest
+		frames, channels int
+		minPSNR          float64
+	}{
+		{models.EmbedRequest{Method: models.MethodEcho, ECC: models.ECCMedium}, echoTestFrames, 1, 30},
+		{models.EmbedRequest{Method: models.MethodPhase, ECC: models.ECCHigh}, 8 * phaseSegment, 2, 25},
+		{models.EmbedRequest{Method: models.MethodDSSS, ECC: models.ECCMedium, DSSS: &models.DSSSParams{ChipRate: 256, Gain: 0.05}}, 700000, 1, 30},
+		{models.EmbedRequest{Method: models.MethodQIM, ECC: models.ECCHigh, QIMStep: 128, UseScatter: true}, 20000, 2, 30},
+		{models.EmbedRequest{Method: models.MethodDCT, ECC: models.ECCMedium, UseScatter: true}, 40 * dctBlock, 2, 30},
+	} {
+		t.Run(string(tc.req.Method), func(t *testing.T) {
+			cover := testWAV(tc.frames, tc.channels)
+			req := tc.req
+			req.CoverAudio, req.StegoKey, req.KDF = cover, "signal key", testKDF
+			stego, distortion := testRoundTrip(t, req, []byte("hidden in the decoded audio"))
+			if distortion.PSNR < tc.minPSNR {
+				t.Fatalf("PSNR %.1f dB", distortion.PSNR)
+			}
+
+			s := newTestStegoService()
+			if _, err := s.ExtractContainer(&models.ExtractRequest{StegoKey: "other key", KDF: testKDF, Method: req.Method}, stego); err == nil {
+				t.Fatal("extracted with the wrong key")
+			}
+			if _, err := s.ExtractContainer(&models.ExtractRequest{Method: req.Method}, cover); err != models.ErrExtractionFailed {
+				t.Fatalf("cover: got %v", err)
+			}
+		})
+	}
+}
+
+// A block corrects up to half its parity bytes, wherever they sit
+func TestReedSolomonCorrectsByteErrors(t *testing.T) {
+	rng := mathrand.New(mathrand.NewSource(2))
+	data := make([]byte, rsBlockSize-32)
+	rng.Read(data)
+	codeword := rsEncode(data, 32)
+	for _, errors := range []int{1, 8, 16, 17} {
+		corrupted := append([]byte(nil), codeword...)
+		for _, i := range rng.Perm(len(corrupted))[:errors] {
+			corrupted[i] ^= byte(1 + rng.Intn(255))
+		}
+		got, err := rsDecode(corrupted, 32)
+		if errors <= 16 && (err != nil || !bytes.Equal(got, data)) {
+			t.Fatalf("%d errors: not corrected (%v)", errors, err)
+		}
+		if errors > 16 && err == nil {
+			t.Fatalf("%d errors: decoded", errors)
+		}
+	}
+}
+
+// Flipped carrier bits break a container without ECC and are corrected with it
+func TestECCSurvivesCorruptedCarrier(t *testing.T) {
+	secret := []byte("corrected by Reed–Solomon parity")
+	for _, level := range []models.ECCLevel{models.ECCNone, models.ECCHigh} {
+		s := newTestStegoService()
+		req := models.EmbedRequest{CoverAudio: testWAV(50000, 1), Method: models.MethodLSB, NLsb: 1, ECC: level}
+		stego, _, err := s.EmbedMessage(&req, secret, nil)
+		if err != nil {
+			t.Fatalf("ECC %q: %v", level, err)
+		}
+		// one flipped LSB in every 150 samples
+		samples := pcmRegion(stego)
+		for i := 0; i < len(samples); i += 2 * 150 {
+			samples[i] ^= 1
+		}
+		result, err := s.ExtractContainer(&models.ExtractRequest{Method: models.MethodLSB}, stego)
+		recovered := err == nil && bytes.Equal(result.SecretData, secret)
+		if recovered != (level == models.ECCHigh) {
+			t.Fatalf("ECC %q: recovered %v (%v)", level, recovered, err)
+		}
+	}
+}
+
+// A flipped payload bit fails the integrity tag, with and without a key, and is reported apart from
+// a wrong key, which a public header lets the reader tell
+func TestIntegrityTagReportsTampering(t *testing.T) {
+	secret := make([]byte, 2000)
+	mathrand.New(mathrand.NewSource(3)).Read(secret)
+	for _, key := range []string{"", "integrity key"} {
+		s := newTestStegoService()
+		req := models.EmbedRequest{CoverAudio: testWAV(50000, 1), Method: models.MethodLSB, NLsb: 1,
+			StegoKey: key, KDF: testKDF, UseEncryption: key != "", Cipher: models.CipherAESGCM, PublicHeader: true}
+		stego, _, err := s.EmbedMessage(&req, secret, nil)
+		if err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		if key != "" {
+			if _, err := s.ExtractContainer(&models.ExtractRequest{StegoKey: "other key", KDF: testKDF, Method: models.MethodLSB}, stego); err != models.ErrInvalidStegoKey {
+				t.Fatalf("wrong key: got %v", err)
+			}
+		}
+		// the LSB of a sample in the middle of the payload
+		pcmRegion(stego)[2*8*1000] ^= 1
+		if _, err := s.ExtractContainer(&models.ExtractRequest{StegoKey: key, KDF: testKDF, Method: models.MethodLSB}, stego); err != models.ErrIntegrityFailed {
+			t.Fatalf("key %q: got %v", key, err)
+		}
+	}
+}
+
+// The fit reported for a secret counts the container overhead, so it agrees with embedding exactly
+func TestSecretFitsMatchesEmbedding(t *testing.T) {
+	s := newTestStegoService()
+	req := models.EmbedRequest{CoverAudio: testWAV(8000, 1), SecretFileName: "random.bin", Method: models.MethodLSB, NLsb: 1,
+		StegoKey: "fit key", KDF: testKDF, UseEncryption: true, Cipher: models.CipherAESGCM, ECC: models.ECCLow}
+	random := make([]byte, 1000)
+	mathrand.New(mathrand.NewSource(4)).Read(random)
+	// the largest incompressible secret reported to fit
+	size := 1000
+	for ; size > 0; size-- {
+		if fits, err := s.SecretFits(&req, random[:size]); err != nil {
+			t.Fatal(err)
+		} else if fits {
+			break
+		}
+	}
+	if size >= 1000 || size == 0 {
+		t.Fatalf("largest fit %d bytes", size)
+	}
+	if _, _, err := s.EmbedMessage(&req, random[:size], nil); err != nil {
+		t.Fatalf("%d bytes reported to fit: %v", size, err)
+	}
+	if _, _, err := s.EmbedMessage(&req, random[:size+1], nil); err != models.ErrInsufficientCapacity {
+		t.Fatalf("%d bytes reported not to fit: %v", size+1, err)
+	}
+}
+
+// A sharded secret is reassembled from its stego files in any order; with one missing the report
+// tells which, and a single shard is not mistaken for the secret
+func TestShardSetMissingPart(t *testing.T) {
+	s := newTestStegoService()
+	secret := make([]byte, 3000)
+	mathrand.New(mathrand.NewSource(5)).Read(secret)
+	req := models.EmbedRequest{Method: models.MethodLSB, NLsb: 1, StegoKey: "shard key", KDF: testKDF}
+	covers := [][]byte{testWAV(12000, 1), testWAV(16000, 1), testWAV(12000, 1)}
+	stegoFiles, _, err := s.EmbedShards(&req, covers, secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extractReq := &models.ExtractRequest{StegoKey: "shard key", KDF: testKDF}
+
+	result, report, err := s.ExtractShards(extractReq, [][]byte{stegoFiles[2], stegoFiles[0], stegoFiles[1]})
+	if err != nil || !bytes.Equal(result.SecretData, secret) || len(report.Missing) != 0 {
+		t.Fatalf("complete set: %v, report %+v", err, report)
+	}
+
+	_, report, err = s.ExtractShards(extractReq, [][]byte{stegoFiles[2], stegoFiles[0]})
+	if err != models.ErrIncompleteShardSet || report == nil || report.Count != 3 ||
+		len(report.Found) != 2 || report.Found[0] != 1 || report.Found[1] != 3 || len(report.Missing) != 1 || report.Missing[0] != 2 {
+		t.Fatalf("shard 2 missing: %v, report %+v", err, report)
+	}
+
+	if _, err := s.ExtractContainer(extractReq, stegoFiles[0]); err != models.ErrShardedSecret {
+		t.Fatalf("single shard: got %v", err)
+	}
+}
+
+// Any threshold shares recover the secret, one fewer interpolate to something else
+func TestShamirThreshold(t *testing.T) {
+	secret := []byte("split over GF(2^8)")
+	shares, err := shamirSplit(secret, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for a := 1; a <= 5; a++ {
+		for b := a + 1; b <= 5; b++ {
+			got, err := shamirCombine([]byte{byte(a), byte(b)}, [][]byte{shares[a-1], shares[b-1]})
+			if err == nil && bytes.Equal(got, secret) {
+				t.Fatalf("shares %d and %d recovered the secret", a, b)
+			}
+			for c := b + 1; c <= 5; c++ {
+				got, err := shamirCombine([]byte{byte(c), byte(a), byte(b)}, [][]byte{shares[c-1], shares[a-1], shares[b-1]})
+				if err != nil || !bytes.Equal(got, secret) {
+					t.Fatalf("shares %d, %d and %d: %q, %v", a, b, c, got, err)
+				}
+			}
+		}
+	}
+}
+
+// Stego files of a share set recover the secret from any threshold of them and report how many
+// are still needed below it
+func TestShareSetThreshold(t *testing.T) {
+	s := newTestStegoService()
+	secret := []byte("any two of three covers")
+	req := models.EmbedRequest{Method: models.MethodLSB, NLsb: 1, StegoKey: "share key", KDF: testKDF}
+	stegoFiles, _, err := s.EmbedShares(&req, [][]byte{testWAV(8000, 1), testWAV(8000, 1), testWAV(8000, 1)}, secret, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extractReq := &models.ExtractRequest{StegoKey: "share key", KDF: testKDF}
+	for _, pair := range [][2]int{{0, 1}, {2, 0}, {1, 2}} {
+		result, _, err := s.ExtractShares(extractReq, [][]byte{stegoFiles[pair[0]], stegoFiles[pair[1]]})
+		if err != nil || !bytes.Equal(result.SecretData, secret) {
+			t.Fatalf("stego files %v: %v", pair, err)
+		}
+	}
+	// the same share twice is still one share
+	_, report, err := s.ExtractShares(extractReq, [][]byte{stegoFiles[1], stegoFiles[1]})
+	if err != models.ErrNotEnoughShares || report == nil || report.Needed != 1 || len(report.Found) != 1 || report.Found[0] != 2 {
+		t.Fatalf("one share: %v, report %+v", err, report)
+	}
+}
+
+// A secret encrypted to recipients is read with the private key of any of them and no stego key;
+// an identity file is not a recipients file
+func TestRecipientEncryption(t *testing.T) {
+	s := newTestStegoService()
+	crypto := NewCryptographyService()
+	var publics, privates [][]byte
+	for i := 0; i < 3; i++ {
+		pair, err := crypto.GenerateKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		public, err := crypto.ParseRecipients([]byte(pair.PublicKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		private, err := crypto.ParseIdentities(pair.IdentityFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := crypto.ParseRecipients(pair.IdentityFile()); err != models.ErrInvalidRecipient {
+			t.Fatalf("identity file as recipients: got %v", err)
+		}
+		publics, privates = append(publics, public...), append(privates, private...)
+	}
+
+	secret := []byte("for the first two recipients")
+	req := models.EmbedRequest{CoverAudio: testWAV(20000, 1), Method: models.MethodLSB, NLsb: 1, Recipients: publics[:2]}
+	stego, _, err := s.EmbedMessage(&req, secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, identities := range [][][]byte{{privates[0]}, {privates[2], privates[1]}} {
+		result, err := s.ExtractContainer(&models.ExtractRequest{Identities: identities}, stego)
+		if err != nil || !bytes.Equal(result.SecretData, secret) {
+			t.Fatalf("identities %d: %v", i, err)
+		}
+	}
+	for _, identities := range [][][]byte{nil, {privates[2]}} {
+		if _, err := s.ExtractContainer(&models.ExtractRequest{Identities: identities, Method: models.MethodLSB}, stego); err != models.ErrNoMatchingIdentity {
+			t.Fatalf("%d unrelated identities: got %v", len(identities), err)
+		}
+	}
+}
+
+// The signature is reported as verified for a trusted signer, untrusted for another valid one and
+// invalid when it does not match the signed data
+func TestSignatureStatus(t *testing.T) {
+	s := newTestStegoService()
+	crypto := NewCryptographyService()
+	var seeds, signers [][]byte
+	var names []string
+	for i := 0; i < 2; i++ {
+		pair, err := crypto.GenerateSigningKeyPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		seed, err := crypto.ParseSigningKey([]byte(pair.PrivateKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := crypto.ParseSigners([]byte(pair.PublicKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds, signers, names = append(seeds, seed), append(signers, signer...), append(names, pair.PublicKey)
+	}
+
+	cover := testWAV(20000, 1)
+	for _, tc := range []struct {
+		signingKey []byte
+		trusted    [][]byte
+		want       models.SignatureInfo
+	}{
+		{nil, signers, models.SignatureInfo{Status: models.SignatureUnsigned}},
+		{seeds[0], signers[:1], models.SignatureInfo{Status: models.SignatureVerified, Signer: names[0]}},
+		{seeds[0], signers[1:], models.SignatureInfo{Status: models.SignatureUntrusted, Signer: names[0]}},
+		{seeds[1], signers, models.SignatureInfo{Status: models.SignatureVerified, Signer: names[1]}},
+	} {
+		req := models.EmbedRequest{CoverAudio: cover, Method: models.MethodLSB, NLsb: 1, SigningKey: tc.signingKey}
+		stego, _, err := s.EmbedMessage(&req, []byte("signed by the sender"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := s.ExtractContainer(&models.ExtractRequest{TrustedSigners: tc.trusted}, stego)
+		if err != nil || result.Signature != tc.want {
+			t.Fatalf("want %+v: got %+v, %v", tc.want, result.Signature, err)
+		}
+	}
+
+	signed := []byte("header and payload")
+	signature, err := crypto.Sign(signed, seeds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed[0] ^= 1
+	info := s.checkSignature(&models.ExtractRequest{TrustedSigners: signers}, &containerHeader{signer: signers[0]}, signed, signature)
+	if info.Status != models.SignatureInvalid || info.Signer != names[0] {
+		t.Fatalf("changed data: got %+v", info)
+	}
+}
+
+// Each key of a deniable embedding reads its own layer only
+func TestDeniableLayers(t *testing.T) {
+	s := newTestStegoService()
+	decoy, hidden := []byte("the decoy anyone may see"), []byte("the hidden secret")
+	decoyReq := models.EmbedRequest{CoverAudio: testWAV(30000, 1), Method: models.MethodLSB, NLsb: 1, StegoKey: "decoy key", KDF: testKDF}
+	hiddenReq := models.EmbedRequest{StegoKey: "hidden key", UseEncryption: true, Cipher: models.CipherAESGCM}
+	for _, withHidden := range []bool{true, false} {
+		var stego []byte
+		var err error
+		if withHidden {
+			stego, _, err = s.EmbedDeniable(&decoyReq, decoy, &hiddenReq, hidden)
+		} else {
+			stego, _, err = s.EmbedDeniable(&decoyReq, decoy, nil, nil)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range map[string][]byte{"decoy key": decoy, "hidden key": hidden, "other key": nil} {
+			if !withHidden && key == "hidden key" {
+				want = nil
+			}
+			result, err := s.ExtractContainer(&models.ExtractRequest{StegoKey: key, KDF: testKDF}, stego)
+			if want == nil && err == nil {
+				t.Fatalf("hidden layer %v, %s: extracted %q", withHidden, key, result.SecretData)
+			}
+			if want != nil && (err != nil || !bytes.Equal(result.SecretData, want)) {
+				t.Fatalf("hidden layer %v, %s: %v", withHidden, key, err)
+			}
+		}
+	}
+
+	if _, _, err := s.EmbedDeniable(&decoyReq, decoy, &models.EmbedRequest{StegoKey: "decoy key"}, hidden); err != models.ErrDeniableKeys {
+		t.Fatalf("same key: got %v", err)
+	}
+	keyed := decoyReq
+	keyed.Method = models.MethodQIM
+	if _, _, err := s.EmbedDeniable(&keyed, decoy, &hiddenReq, hidden); err != models.ErrDeniableMethod {
+		t.Fatalf("keyed method: got %v", err)
+	}
+}
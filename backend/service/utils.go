@@ -1,10 +1,13 @@
 package service
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"hash/fnv"
 	"log"
+	"math/bits"
 	"strings"
 )
 
@@ -226,6 +229,50 @@ func parseWAVHeader(wavData []byte) (dataOffset int, dataSize uint32, err error)
 	return 0, 0, fmt.Errorf("WAV file does not contain a data chunk")
 }
 
+// parseWAVFormat parses the fmt chunk of a WAV file and returns the sample layout
+func parseWAVFormat(wavData []byte) (formatTag, channels, sampleRate, bitsPerSample int, err error) {
+	if len(wavData) < 12 || string(wavData[:4]) != "RIFF" || string(wavData[8:12]) != "WAVE" {
+		return 0, 0, 0, 0, fmt.Errorf("invalid WAV file: missing RIFF/WAVE header")
+	}
+
+	offset := 12
+	for offset+8 <= len(wavData) {
+		chunkID := string(wavData[offset : offset+4])
+		chunkSize := binary.LittleEndian.Uint32(wavData[offset+4 : offset+8])
+
+		if chunkID == "fmt " {
+			if chunkSize < 16 || offset+8+16 > len(wavData) {
+				return 0, 0, 0, 0, fmt.Errorf("invalid WAV file: fmt chunk too short")
+			}
+			fmtData := wavData[offset+8:]
+			formatTag = int(binary.LittleEndian.Uint16(fmtData[0:2]))
+			channels = int(binary.LittleEndian.Uint16(fmtData[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(fmtData[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(fmtData[14:16]))
+
+			log.Printf("[DEBUG] parseWAVFormat: format=%d, channels=%d, sample_rate=%d, bits_per_sample=%d",
+				formatTag, channels, sampleRate, bitsPerSample)
+			return formatTag, channels, sampleRate, bitsPerSample, nil
+		}
+
+		nextOffset := offset + 8 + int(chunkSize)
+		if chunkSize%2 == 1 {
+			nextOffset++
+		}
+		if nextOffset <= offset {
+			return 0, 0, 0, 0, fmt.Errorf("invalid WAV file: infinite loop detected in chunk parsing")
+		}
+		offset = nextOffset
+	}
+
+	return 0, 0, 0, 0, fmt.Errorf("WAV file does not contain a fmt chunk")
+}
+
+// isWAVData checks if data starts with a RIFF/WAVE signature
+func isWAVData(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
 // hasExtension checks if a filename has an extension
 func hasExtension(filename string) bool {
 	for i := len(filename) - 1; i >= 0; i-- {
@@ -354,7 +401,17 @@ func extractParityBit(b byte) uint8 {
 	return calculateParity(b)
 }
 
-// calculateChecksum calculates a simple 4-byte checksum for data integrity verification
+// keyedChecksum calculates a 4-byte check value as truncated HMAC-SHA256 under the integrity subkey
+func keyedChecksum(key []byte, data []byte) [4]byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	var checksum [4]byte
+	copy(checksum[:], mac.Sum(nil))
+	return checksum
+}
+
+// calculateChecksum calculates the simple 4-byte XOR checksum of encrypted payloads in stego files from
+// older versions. Current containers are protected by integrityTag instead.
 func calculateChecksum(data []byte) [4]byte {
 	var checksum [4]byte
 	for i, b := range data {
@@ -362,3 +419,17 @@ func calculateChecksum(data []byte) [4]byte {
 	}
 	return checksum
 }
+
+// log2 returns the base-2 logarithm of a power of two
+func log2(n int) int {
+	return bits.TrailingZeros(uint(n))
+}
+
+// exponents returns the base-2 logarithm of every power of two in values
+func exponents(values []int) []int {
+	out := make([]int, len(values))
+	for i, v := range values {
+		out[i] = log2(v)
+	}
+	return out
+}